@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 
@@ -15,6 +17,9 @@ func main() {
 	root := cli.BuildRootCmd()
 	if err := cli.Execute(root, fang.WithoutCompletions(), fang.WithoutManpage(), fang.WithoutVersion()); err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
+		if errors.Is(err, context.Canceled) {
+			os.Exit(130) // interrupted, as if by SIGINT
+		}
 		os.Exit(1)
 	}
 }
@@ -9,6 +9,9 @@ require (
 	github.com/openai/openai-go/v2 v2.3.0
 	github.com/spf13/cobra v1.9.1
 	golang.org/x/sync v0.16.0
+	golang.org/x/sys v0.33.0
+	gopkg.in/yaml.v3 v3.0.1
+	mvdan.cc/sh/v3 v3.12.0
 )
 
 require (
@@ -39,6 +42,5 @@ require (
 	github.com/tidwall/sjson v1.2.5 // indirect
 	github.com/xo/terminfo v0.0.0-20220910002029-abceb7e1c41e // indirect
 	golang.org/x/exp v0.0.0-20231006140011-7918f672742d // indirect
-	golang.org/x/sys v0.33.0 // indirect
 	golang.org/x/text v0.24.0 // indirect
 )
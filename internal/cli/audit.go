@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"cds.agents.app/pkg"
+	"github.com/spf13/cobra"
+)
+
+// buildAuditCmd defines `agent audit` and its verify subcommand.
+// Flow: attached to the root command by BuildRootCmd().
+// Yields: no; returns cobra.Command to execute.
+func buildAuditCmd() *cobra.Command {
+	audit := &cobra.Command{
+		Use:   "audit",
+		Short: "Inspect run audit logs",
+	}
+
+	verify := &cobra.Command{
+		Use:   "verify <log>",
+		Short: "Check an audit log for tampering or truncation",
+		Long:  "Recomputes the SHA-256 chain of an audit log written by --audit-log and checks that it ends with the run_end record.\n\nExamples:\n  agent audit verify .agent/runs/20250101-120000-1a2b/audit.jsonl",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			cmd.SilenceUsage = true
+			s, err := pkg.VerifyAudit(f)
+			if err != nil {
+				return fmt.Errorf("%s: verification failed: %w", args[0], err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s: ok, %d records from %s to %s, head %s\n", args[0], s.Records, s.First, s.Last, s.Head)
+			return nil
+		},
+	}
+
+	audit.AddCommand(verify)
+	return audit
+}
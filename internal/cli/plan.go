@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	"cds.agents.app/internal/services/agent"
+	"cds.agents.app/pkg"
+	"github.com/spf13/cobra"
+)
+
+// buildPlanCmd defines `agent plan`, which phases tool calls offline.
+// Flow: attached to the root command by BuildRootCmd().
+// Yields: no; returns cobra.Command to execute.
+func buildPlanCmd() *cobra.Command {
+	var (
+		src    string
+		format string
+	)
+
+	plan := &cobra.Command{
+		Use:   "plan",
+		Short: "Show how a turn's tool calls would be phased",
+		Long:  "Reads a JSON array of tool calls from stdin and prints the phases the agent would run them in and why each ordering constraint exists. Nothing is executed and no model is called.\n\nEach call is {\"name\": ..., \"arguments\": ...}; arguments may be an object or a JSON string, as in the tool_calls of an audit log.\n\nExamples:\n  echo '[{\"name\":\"write_file\",\"arguments\":{\"path\":\"a/b.txt\"}},{\"name\":\"run_command\",\"arguments\":{\"cmd\":\"cat a/b.txt\"}}]' | agent plan\n  agent plan --format dot < calls.json | dot -Tsvg > plan.svg",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "text" && format != "dot" && format != "mermaid" {
+				return fmt.Errorf("--format %q: want text, dot or mermaid", format)
+			}
+			data, err := io.ReadAll(cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+			calls, err := pkg.ParsePlanCalls(data)
+			if err != nil {
+				return err
+			}
+			p := (&agent.Agent{}).Plan(src, calls)
+			if format == "text" {
+				fmt.Fprint(cmd.OutOrStdout(), p.Text())
+				return nil
+			}
+			fmt.Fprint(cmd.OutOrStdout(), pkg.RenderPlans(format, []pkg.Plan{p}))
+			return nil
+		},
+	}
+	plan.Flags().StringVar(&src, "src", ".", "source directory the call paths are relative to")
+	plan.Flags().StringVar(&format, "format", "text", "output: text|dot|mermaid")
+
+	return plan
+}
@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"cds.agents.app/pkg"
+	"github.com/spf13/cobra"
+)
+
+// buildPolicyCmd defines `agent policy` and its check subcommand.
+// Flow: attached to the root command by BuildRootCmd().
+// Yields: no; returns cobra.Command to execute.
+func buildPolicyCmd() *cobra.Command {
+	var (
+		src        string
+		policyFile string
+	)
+
+	policy := &cobra.Command{
+		Use:   "policy",
+		Short: "Inspect the tool, path and command policy",
+	}
+
+	check := &cobra.Command{
+		Use:   "check <tool> [json-args]",
+		Short: "Test a tool call against the policy",
+		Long:  "Evaluates a single tool call exactly as the agent would before running it.\n\nExamples:\n  agent policy check write_file '{\"path\":\"go.sum\"}'\n  agent policy check run_command '{\"cmd\":\"git push origin main\"}'\n  agent policy check --policy ci-policy.yaml delete_path '{\"path\":\"docs\"}'",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, path, err := pkg.ResolvePolicy(src, policyFile)
+			if err != nil {
+				return err
+			}
+			if path == "" {
+				path = "built-in default"
+			}
+			callArgs := map[string]any{}
+			if len(args) == 2 {
+				if err := json.Unmarshal([]byte(args[1]), &callArgs); err != nil {
+					return fmt.Errorf("json-args: %w", err)
+				}
+			}
+			cmd.SilenceUsage = true
+			if err := p.Check(src, args[0], callArgs); err != nil {
+				return fmt.Errorf("denied by %s: %w", path, err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "allowed by %s\n", path)
+			return nil
+		},
+	}
+	check.Flags().StringVar(&src, "src", ".", "source directory the call would run in")
+	check.Flags().StringVar(&policyFile, "policy", "", "policy file (default <src>/.agent/policy.yaml when present)")
+
+	policy.AddCommand(check)
+	return policy
+}
@@ -2,7 +2,11 @@ package cli
 
 import (
 	"context"
+	"fmt"
+	"maps"
+	"os"
 	"strings"
+	"syscall"
 	"time"
 
 	"cds.agents.app/internal/services/agent"
@@ -25,19 +29,65 @@ func BuildRootCmd() *cobra.Command {
 		logEnabled   bool
 		toolChoice   string
 		requireTools []string
-
+		dryRun       bool
+		outputPatch  string
+		approve      bool
+		reportMD     string
+		gitCommit    bool
+		commitEach   bool
+		allowDirty   bool
+		policyFile   string
+		protect      []string
+		auditLog     string
+		planGraph    string
+		continueErr  bool
+		toolWeights  []string
+		toolCaps     []string
+		toolTimeouts []string
+		slowCall     time.Duration
 	)
 
 	root := &cobra.Command{
 		Use:   "agent [flags] \"task prompt\"",
 		Short: "Iterative tool-calling code mod agent",
-		Long:  "Agent CLI — plans and executes filesystem tools iteratively to accomplish coding tasks.\n\nExamples:\n  agent --src . --concurrency 6 --steps 16 \"Create README.md and list the directory.\"\n  agent --tool-choice required --require-tool write_file \"Write 'hello' to README.md and then read it.\"\n  agent --tool-choice none \"Explain what this tool does.\"\n  agent --log=true --steps=1000 \"make two short stories in seperate .md files\"",
+		Long:  "Agent CLI — plans and executes filesystem tools iteratively to accomplish coding tasks.\n\nExamples:\n  agent --src . --concurrency 6 --steps 16 \"Create README.md and list the directory.\"\n  agent --tool-choice required --require-tool write_file \"Write 'hello' to README.md and then read it.\"\n  agent --tool-choice none \"Explain what this tool does.\"\n  agent --log=true --steps=1000 \"make two short stories in seperate .md files\"\n  agent --dry-run --output-patch changes.patch \"Rename the config package.\"",
 		Args:  cobra.ArbitraryArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 {
 				return cmd.Help()
 			}
 			prompt := strings.TrimSpace(strings.Join(args, " "))
+			policy, policyPath, err := pkg.ResolvePolicy(src, policyFile)
+			if err != nil {
+				return err
+			}
+			policy.Paths.Protect = append(policy.Paths.Protect, protect...)
+			weights, err := pkg.ParseToolInts("tool-weight", toolWeights)
+			if err != nil {
+				return err
+			}
+			caps, err := pkg.ParseToolInts("tool-concurrency", toolCaps)
+			if err != nil {
+				return err
+			}
+			policy.Schedule.Weights = merged(policy.Schedule.Weights, weights)
+			policy.Schedule.MaxConcurrent = merged(policy.Schedule.MaxConcurrent, caps)
+			timeouts, err := pkg.ParseToolDurations("tool-timeout", toolTimeouts)
+			if err != nil {
+				return err
+			}
+			policy.Limits.ToolTimeouts = merged(policy.Limits.ToolTimeouts, timeouts)
+			if cmd.Flags().Changed("slow-call") {
+				if slowCall < 0 {
+					return fmt.Errorf("--slow-call %s: cannot be negative", slowCall)
+				}
+				policy.Limits.SlowCall = slowCall
+			}
+			if planGraph != "" {
+				if _, err := pkg.PlanGraphFormat(planGraph); err != nil {
+					return err
+				}
+			}
 			config := pkg.Config{
 				Model:        model,
 				Src:          src,
@@ -48,15 +98,33 @@ func BuildRootCmd() *cobra.Command {
 				Log:          logEnabled,
 				ToolChoice:   toolChoice,
 				RequireTools: requireTools,
+				DryRun:       dryRun || outputPatch != "",
+				OutputPatch:  outputPatch,
+				Approve:      approve,
+				ReportMD:     reportMD,
 
+				GitCommit:      gitCommit,
+				CommitEachTurn: commitEach,
+				AllowDirty:     allowDirty,
+
+				AuditLog:    auditLog,
+				PlanGraph:   planGraph,
+				StopOnError: !continueErr,
+
+				Policy:     policy,
+				PolicyPath: policyPath,
 			}
 			a := agent.NewAgent(config)
-			return a.Run()
+			return a.RunContext(cmd.Context())
 		},
 	}
 
 	root.Flags().StringVar(&src, "src", ".", "source directory to operate in (defaults to current directory)")
-	root.Flags().IntVar(&concurrency, "concurrency", 4, "max concurrent tool executions per phase")
+	root.Flags().IntVar(&concurrency, "concurrency", 4, "slots in the run-wide tool-call pool; a call takes its tool's weight (see --tool-weight)")
+	root.Flags().StringArrayVar(&toolWeights, "tool-weight", nil, "slots of --concurrency one call of a tool takes, as tool=N, e.g. run_command=4 (repeatable; overrides scheduling.weights)")
+	root.Flags().StringArrayVar(&toolCaps, "tool-concurrency", nil, "max calls of a tool running at once, as tool=N, e.g. run_command=1 (repeatable; overrides scheduling.max_concurrent)")
+	root.Flags().StringArrayVar(&toolTimeouts, "tool-timeout", nil, "deadline for one call of a read-only tool, as tool=DURATION, e.g. list_dir_recursive=2m (repeatable; overrides limits.tool_timeouts)")
+	root.Flags().DurationVar(&slowCall, "slow-call", 5*time.Second, "log tool calls that take at least this long (0 disables; overrides limits.slow_call)")
 	root.Flags().IntVar(&steps, "steps", 16, "max assistant turns (avoid infinite loops)")
 	root.Flags().StringVar(&model, "model", string(openai.ChatModelGPT4o), "OpenAI chat model (e.g., gpt-4o)")
 	root.Flags().DurationVar(&timeout, "timeout", 600*time.Second, "per-turn API timeout")
@@ -64,13 +132,42 @@ func BuildRootCmd() *cobra.Command {
 
 	root.Flags().StringVar(&toolChoice, "tool-choice", "auto", "tool choice behavior: auto|required|none")
 	root.Flags().StringArrayVar(&requireTools, "require-tool", nil, "require a specific tool to be used (repeatable)")
+	root.Flags().BoolVar(&dryRun, "dry-run", false, "stage writes/deletes in memory and print a unified diff instead of modifying --src")
+	root.Flags().StringVar(&reportMD, "report-md", "", "append a Markdown change report to this file (e.g. $GITHUB_STEP_SUMMARY)")
+	root.Flags().BoolVar(&gitCommit, "git-commit", false, "create an agent/<slug>-<timestamp> branch and commit changes at the end (local git only, no push)")
+	root.Flags().BoolVar(&commitEach, "commit-each-turn", false, "with --git-commit, commit after every turn that changed files (implies --git-commit)")
+	root.Flags().BoolVar(&allowDirty, "allow-dirty", false, "with --git-commit, start even if the working tree has uncommitted changes")
+	root.Flags().BoolVar(&approve, "approve", false, "ask before each write_file, delete_path or writable run_command (approve/deny/edit/always)")
+	root.Flags().StringVar(&policyFile, "policy", "", "policy file for tools, paths and commands (default <src>/.agent/policy.yaml when present)")
+	root.Flags().StringArrayVar(&protect, "protect", nil, "glob relative to --src that no tool may modify, added to the policy's paths.protect (repeatable)")
+	root.Flags().StringVar(&auditLog, "audit-log", "", "hash-chained JSONL audit log of model turns and tool calls (default <src>/.agent/runs/<run-id>/audit.jsonl, not written with --dry-run unless set; \"none\" disables)")
+	root.Flags().StringVar(&planGraph, "plan-graph", "", "write each turn's tool-call dependency graph and phases to this .dot (Graphviz) or .mmd (Mermaid) file")
+	root.Flags().BoolVar(&continueErr, "continue-on-error", true, "after a tool call fails, still run the turn's calls that do not depend on it (false aborts the rest of the turn)")
+	root.Flags().StringVar(&outputPatch, "output-patch", "", "with --dry-run, write the diff to this file instead of stdout")
+
+	root.AddCommand(buildPolicyCmd())
+	root.AddCommand(buildAuditCmd())
+	root.AddCommand(buildPlanCmd())
 
 	return root
 }
 
-// Execute runs the CLI command with Fang integration.
+// Execute runs the CLI command with Fang integration; SIGINT and SIGTERM
+// cancel the context commands run under.
 // Flow: called by main() to start command handling.
-// Yields: returns error for process exit handling.
+// Yields: returns error for process exit handling (wrapping context.Canceled when interrupted).
 func Execute(root *cobra.Command, opts ...fang.Option) error {
+	opts = append(opts, fang.WithNotifySignal(os.Interrupt, syscall.SIGTERM))
 	return fang.Execute(context.Background(), root, opts...)
 }
+
+// merged copies base with over's entries on top, leaving base (which may be
+// the shared default policy's map) untouched.
+func merged[V any](base, over map[string]V) map[string]V {
+	out := maps.Clone(base)
+	if out == nil {
+		out = map[string]V{}
+	}
+	maps.Copy(out, over)
+	return out
+}
@@ -2,10 +2,17 @@ package agent
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"cds.agents.app/pkg"
@@ -29,17 +36,92 @@ type Agent struct {
 	ToolChoice   string
 	RequireTools []string
 	SettingsView string
+
+	// Workspace backend and dry-run overlay (Overlay is also Ws when set)
+	Ws          pkg.Workspace
+	Overlay     *pkg.OverlayWorkspace
+	OutputPatch string
+
+	// Interactive approval gate (--approve)
+	Approve   bool
+	Approver  Approver
+	approvals approvalState
+
+	// End-of-run change report
+	Changes   *pkg.ChangeTracker
+	ReportMD  string
+	cmdWrites atomic.Int32 // writable run_command calls (not tracked per file)
+
+	// Git branch/commit per run (--git-commit)
+	GitCommit      bool
+	CommitEachTurn bool
+	AllowDirty     bool
+	stepsUsed      int
+	gitSkip        []string // changes that predate the run (--allow-dirty), never committed
+
+	// Tool, path and command policy (nil = pkg.DefaultPolicy)
+	Policy      *pkg.Policy
+	PolicyPath  string
+	sandboxWarn sync.Once // degraded run_command sandbox, logged once
+
+	// Masks secrets in tool results, logs and reports
+	Redactor *pkg.Redactor
+
+	// Background processes (start_process), all killed when Run() exits
+	Procs *pkg.ProcessRegistry
+
+	// Per-run artifacts under .agent/runs/<RunID>
+	RunID string
+	calls atomic.Int64 // names calls that arrive without an id
+
+	// Hash-chained record of model turns and tool calls ("" = under RunID, "none" = off)
+	AuditPath string
+	Audit     *pkg.AuditLog
+
+	// Prompt-injection defenses: envelope marker and whether untrusted
+	// output looked like instructions (approval is then required)
+	nonce   string
+	tainted atomic.Bool
+
+	// Run-wide budget for writes, deletions, commands and tool calls
+	Quotas *pkg.QuotaTracker
+
+	// Weighted pool of --concurrency slots that tool calls run in; set it
+	// before Init (or via Config.Scheduler) to share one across agents
+	Scheduler *pkg.Scheduler
+
+	// Abort a turn's remaining phases after a failed call (--continue-on-error=false)
+	StopOnError bool
+
+	// Dependency graph of every turn's plan, as DOT or Mermaid (--plan-graph)
+	PlanGraph string
+	plans     []pkg.Plan
 }
 
 // NewAgent constructs the Agent with initial configuration.
 // Flow: called by CLI to create the agent before any execution.
 // Yields: no yielding; prepares runtime state.
 func NewAgent(config pkg.Config) *Agent {
-	agent := &Agent{}
+	agent := &Agent{Policy: config.Policy, PolicyPath: config.PolicyPath, Scheduler: config.Scheduler}
 	agent.Init(config.Model, config.Src, config.Concurrency, config.Steps, config.Timeout, config.Prompt)
+	agent.protectAgentState()
 	agent.ToolChoice = config.ToolChoice
 	agent.RequireTools = config.RequireTools
+	agent.Approve = config.Approve
+	agent.ReportMD = config.ReportMD
+	agent.GitCommit = config.GitCommit || config.CommitEachTurn
+	agent.CommitEachTurn = config.CommitEachTurn
+	agent.AllowDirty = config.AllowDirty
+	agent.AuditPath = config.AuditLog
+	agent.PlanGraph = config.PlanGraph
+	agent.StopOnError = config.StopOnError
+	if config.DryRun {
+		agent.Overlay = pkg.NewOverlayWorkspace(agent.Src, agent.Ws)
+		agent.Ws = agent.Overlay
+		agent.OutputPatch = config.OutputPatch
+	}
 	lg := pkg.NewLogger(config.Log)
+	lg.SetRedactor(agent.Redactor)
 	agent.Log = lg
 	return agent
 }
@@ -52,30 +134,91 @@ func (a *Agent) Init(model, src string, concurrency, steps int, timeout time.Dur
 	a.setLockManager()
 	a.setModel(model)
 	a.setSrc(src)
+	a.setWorkspace()
+	a.setChangeTracker()
+	a.setRedactor()
+	a.setProcesses()
+	a.setQuotas()
+	a.setRunID()
+	a.setNonce()
 	a.setConcurrency(concurrency)
+	a.setScheduler()
 	a.setSteps(steps)
 	a.setTimeout(timeout)
 	a.setPrompt(prompt)
 }
 
-// Run is the main loop: prompt -> model -> tools -> results -> repeat.
-// Flow: top-level execution after construction.
-// Yields: returns when assistant has no tool calls or when steps exhausted.
+// Run is RunContext with SIGINT/SIGTERM as the cancellation.
+// Flow: top-level execution after construction, for callers without a context.
+// Yields: see RunContext.
 func (a *Agent) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return a.RunContext(ctx)
+}
+
+// RunContext is the main loop: prompt -> model -> tools -> results -> repeat.
+// Cancelling ctx (the CLI cancels it on Ctrl-C) aborts the model call or
+// lets the current phase wind down, then ends the run with the usual
+// report, commit and audit record.
+// Flow: top-level execution after construction.
+// Yields: returns when assistant has no tool calls, when steps are
+// exhausted, or an error wrapping context.Canceled when interrupted.
+func (a *Agent) RunContext(ctx context.Context) (err error) {
 
 	// construct initial prompt
 	a.Prompt()
 
+	if err := a.openAudit(); err != nil {
+		return err
+	}
+	// registered first so the end record is written after finish()
+	defer func() {
+		if aerr := a.closeAudit(err); aerr != nil && err == nil {
+			err = aerr
+		}
+	}()
+
 	a.printConfig()
 
+	if a.GitCommit {
+		if err := a.gitStart(); err != nil {
+			return err
+		}
+	}
+
+	// Change report, dry-run patch and final commit however the run ends
+	defer func() {
+		if ferr := a.finish(ctx, err); ferr != nil && err == nil {
+			err = ferr
+		}
+	}()
+
+	// Background processes never outlive the run, even when interrupted;
+	// a second Ctrl-C while winding down exits at once
+	defer a.Procs.StopAll()
+	stopSignals := a.exitOnSecondSignal(ctx)
+	defer stopSignals()
+
 	// Turn loop: ask model -> maybe tool calls -> run (phased + parallel) -> feed results -> repeat
 	for step := 0; step < a.Steps; step++ {
-		ctx, cancel := context.WithTimeout(context.Background(), a.Timeout)
-		comp, err := a.Client.Chat.Completions.New(ctx, a.Params)
+		a.stepsUsed = step + 1
+		if err := a.auditRequest(a.stepsUsed); err != nil {
+			return err
+		}
+		callCtx, cancel := context.WithTimeout(ctx, a.Timeout)
+		start := time.Now()
+		comp, err := a.Client.Chat.Completions.New(callCtx, a.Params)
 		cancel()
+		if ctx.Err() != nil {
+			return interrupted(ctx)
+		}
 		if err != nil {
 			return fmt.Errorf("openai call: %w", err)
 		}
+		if err := a.auditResponse(a.stepsUsed, comp, time.Since(start)); err != nil {
+			return err
+		}
 		if len(comp.Choices) == 0 {
 			return errors.New("empty completion")
 		}
@@ -101,12 +244,30 @@ func (a *Agent) Run() error {
 		toolCalls := pkg.ExtractToolCalls(msg)
 
 		// Build dependency-aware phases for all tool calls in this turn.
-		phases, err := a.PlanPhases(a.Src, toolCalls)
-		if err != nil {
+		plan := a.Plan(a.Src, toolCalls)
+		plan.Turn = a.stepsUsed
+		if err := a.writePlanGraph(plan); err != nil {
 			return err
 		}
 
-		a.RunPhases(toolCalls, phases, msg)
+		a.RunPhasesContext(ctx, toolCalls, plan.Phases, msg)
+
+		// Interrupted: the phase wound down; report what was done so far
+		if ctx.Err() != nil {
+			return interrupted(ctx)
+		}
+
+		// A refused call means a quota is used up: stop before the next turn
+		if err := a.Quotas.Exceeded(); err != nil {
+			a.Log.Warn("quota: " + a.Quotas.Usage())
+			return fmt.Errorf("stopped: %w", err)
+		}
+
+		if a.CommitEachTurn {
+			if err := a.gitCommit(ctx, a.stepsUsed, fmt.Sprintf("turn %d", a.stepsUsed)); err != nil {
+				return err
+			}
+		}
 
 		// After executing tools, verify required tools were called in this turn
 		if missing := missingRequiredTools(a.RequireTools, toolCalls); len(missing) > 0 {
@@ -153,13 +314,40 @@ func (a *Agent) printConfig() {
 	a.Log.Info("  Current src: " + a.Src)
 	a.Log.Info(fmt.Sprintf("  Max steps  : %d", a.Steps))
 	a.Log.Info(fmt.Sprintf("  Timeout    : %s", a.Timeout.String()))
-	a.Log.Info(fmt.Sprintf("  Concurrency: %d", a.Concurrency))
+	a.Log.Info("  Concurrency: " + a.Scheduler.String())
 	if a.ToolChoice != "" {
 		a.Log.Info("  Tool choice: " + a.ToolChoice)
 	}
 	if len(a.RequireTools) > 0 {
 		a.Log.Info("  Need Tools : " + strings.Join(a.RequireTools, ", "))
 	}
+	if a.PolicyPath != "" {
+		a.Log.Info("  Policy     : " + a.PolicyPath)
+	}
+	a.Log.Info("  Sandbox    : " + pkg.SandboxStatus(a.Policy.SandboxSettings().Mode))
+	q := a.Policy.QuotaSettings()
+	a.Log.Info(fmt.Sprintf("  Quotas     : %d files, %s written, %d deletions, %d commands (0 = unlimited)", q.MaxFilesWritten, pkg.FormatBytes(q.MaxBytesWritten), q.MaxDeletions, q.MaxCommands))
+	if globs := a.Policy.ProtectedGlobs(); len(globs) > 0 {
+		a.Log.Info("  Protected  : " + strings.Join(globs, ", "))
+	}
+	if a.Overlay != nil {
+		a.Log.Info("  Dry run    : writes staged in memory")
+	}
+	if a.Approve {
+		a.Log.Info("  Approval   : required for writes, deletes and writable commands")
+	}
+	if a.GitCommit {
+		a.Log.Info(fmt.Sprintf("  Git commit : on (each turn: %v)", a.CommitEachTurn))
+	}
+	if a.Audit != nil {
+		a.Log.Info("  Audit log  : " + a.Audit.Path)
+	}
+	if a.PlanGraph != "" {
+		a.Log.Info("  Plan graph : " + a.PlanGraph)
+	}
+	if a.StopOnError {
+		a.Log.Info("  On error   : abort the rest of the turn")
+	}
 	a.Log.Info("")
 }
 
@@ -198,6 +386,15 @@ func (a *Agent) setConcurrency(concurrency int) {
 	a.Concurrency = concurrency
 }
 
+// setScheduler creates the run's tool-call pool unless one is shared in.
+// Flow: during Init, after setConcurrency.
+// Yields: none.
+func (a *Agent) setScheduler() {
+	if a.Scheduler == nil {
+		a.Scheduler = pkg.NewScheduler(a.Concurrency, a.Policy.ScheduleSettings())
+	}
+}
+
 // setSteps defines the maximum assistant turns.
 // Flow: during Init.
 // Yields: none.
@@ -219,6 +416,71 @@ func (a *Agent) setLockManager() {
 	a.Lm = pkg.NewLockManager()
 }
 
+// setWorkspace installs the real-disk backend unless one was provided.
+// Flow: during Init, after setSrc.
+// Yields: none.
+func (a *Agent) setWorkspace() {
+	if a.Ws == nil {
+		a.Ws = pkg.NewOSWorkspace(a.Src)
+	}
+}
+
+// setChangeTracker prepares snapshots for the end-of-run change report.
+// Flow: during Init, after setSrc.
+// Yields: none.
+func (a *Agent) setChangeTracker() {
+	a.Changes = pkg.NewChangeTracker(a.Src)
+}
+
+// setRedactor collects secret values from the environment (and the policy's
+// env.secrets) for masking.
+// Flow: during Init; the policy must already be set.
+// Yields: none.
+func (a *Agent) setRedactor() {
+	a.Redactor = pkg.NewRedactor(os.Environ(), a.Policy.EnvSettings().Secrets)
+}
+
+// setRunID names this run's artifact directory, e.g. 20250101-120000-1a2b.
+// Flow: during Init.
+// Yields: none.
+func (a *Agent) setRunID() {
+	var b [2]byte
+	_, _ = rand.Read(b[:])
+	a.RunID = time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b[:])
+}
+
+// runPath locates an artifact of this run under --src/.agent/runs/<RunID>.
+func (a *Agent) runPath(elem ...string) string {
+	return filepath.Join(append([]string{a.Src, filepath.FromSlash(pkg.RunsDir), a.RunID}, elem...)...)
+}
+
+// callName is a file-safe name for a tool call; calls without an id are numbered.
+func (a *Agent) callName(callID string) string {
+	if callID == "" {
+		return fmt.Sprintf("call-%d", a.calls.Add(1))
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return '_'
+	}, callID)
+}
+
+// setQuotas starts the run's quota accounting from the policy.
+// Flow: during Init; the policy must already be set.
+// Yields: none.
+func (a *Agent) setQuotas() {
+	a.Quotas = pkg.NewQuotaTracker(a.Policy.QuotaSettings())
+}
+
+// setProcesses creates the registry of background processes.
+// Flow: during Init.
+// Yields: none.
+func (a *Agent) setProcesses() {
+	a.Procs = pkg.NewProcessRegistry(maxProcesses)
+}
+
 // setPrompt records the initial natural-language task.
 // Flow: during Init.
 // Yields: none.
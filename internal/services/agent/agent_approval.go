@@ -0,0 +1,342 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"cds.agents.app/pkg"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ApprovalRequest describes a mutating tool call awaiting a decision.
+type ApprovalRequest struct {
+	Tool    string
+	Args    string
+	Kind    string // grouping key for "always allow", e.g. write_file or run_command:git:writes; "" when it cannot be offered
+	Preview string // colored diff, deletion list or exact command
+}
+
+// Approval is the user's answer to an ApprovalRequest.
+type Approval struct {
+	Allow   bool
+	Reason  string // denial reason fed back to the model
+	Args    string // replacement arguments when the user edited the call
+	Always  bool   // allow this kind for the rest of the run
+	Persist bool   // also record the kind in the per-repo allowlist
+}
+
+// Approver decides whether a gated tool call may run.
+// Flow: consulted by Review() before RunPhases executes a mutating call.
+type Approver interface {
+	Approve(req ApprovalRequest) (Approval, error)
+}
+
+// approvalState tracks kinds the user chose to always allow.
+type approvalState struct {
+	mu     sync.Mutex
+	always map[string]bool
+}
+
+// Review gates a tool call on the policy and, in --approve mode or after a
+// suspected prompt injection, the user.
+// Flow: called by RunPhases sequentially before a phase starts.
+// Yields: the (possibly edited) arguments, or an error carrying the denial reason.
+func (a *Agent) Review(name, rawArgs string) (string, error) {
+	var parsed map[string]any
+	_ = json.Unmarshal([]byte(rawArgs), &parsed)
+	var perr *pkg.PolicyError
+	if err := a.Policy.Check(a.Src, name, parsed); errors.As(err, &perr) {
+		return "", err
+	}
+	// suspected prompt injection turns the gate on for the rest of the run
+	if !(a.Approve || a.Tainted()) || !needsApproval(name, rawArgs) {
+		return rawArgs, nil
+	}
+	kind := approvalKind(name, rawArgs)
+	if kind != "" && a.alwaysAllowed(kind) {
+		return rawArgs, nil
+	}
+	if a.Approver == nil {
+		a.Approver = NewTerminalApprover(os.Stdin, os.Stderr)
+	}
+	ans, err := a.Approver.Approve(ApprovalRequest{Tool: name, Args: rawArgs, Kind: kind, Preview: a.approvalPreview(name, rawArgs)})
+	if err != nil {
+		return "", fmt.Errorf("denied: approval unavailable: %w", err)
+	}
+	if !ans.Allow {
+		reason := ans.Reason
+		if reason == "" {
+			reason = "no reason given"
+		}
+		return "", fmt.Errorf("denied by user: %s", reason)
+	}
+	if (ans.Always || ans.Persist) && kind != "" {
+		a.allowKind(kind, ans.Persist)
+	}
+	if ans.Args != "" {
+		return ans.Args, nil
+	}
+	return rawArgs, nil
+}
+
+// needsApproval reports whether a call mutates the workspace.
+func needsApproval(name, rawArgs string) bool {
+	switch name {
+	case "write_file", "delete_path":
+		return true
+	case "run_command", "start_process":
+		var args map[string]any
+		_ = json.Unmarshal([]byte(rawArgs), &args)
+		return strings.Contains(fmt.Sprint(args["permissions"]), "w")
+	}
+	return false
+}
+
+// approvalKind groups calls for "always allow": commands by every program
+// they run and whether they write, so allowing `git status` never covers
+// `git status && rm -rf src` or `git commit`. Commands that cannot be
+// analyzed or that run scripts the model may have written get "", which is
+// never allowed without asking.
+func approvalKind(name, rawArgs string) string {
+	if name != "run_command" && name != "start_process" {
+		return name
+	}
+	var args map[string]any
+	_ = json.Unmarshal([]byte(rawArgs), &args)
+	an, err := pkg.AnalyzeCommand(fmt.Sprint(args["cmd"]))
+	if err != nil || len(an.Calls) == 0 || len(an.ExecPaths) > 0 {
+		return ""
+	}
+	progs := an.Programs()
+	sort.Strings(progs)
+	kind := name + ":" + strings.Join(slices.Compact(progs), ",")
+	if an.Writes {
+		kind += ":writes"
+	}
+	return kind
+}
+
+func (a *Agent) alwaysAllowed(kind string) bool {
+	a.approvals.mu.Lock()
+	defer a.approvals.mu.Unlock()
+	if a.approvals.always == nil {
+		a.approvals.always = map[string]bool{}
+		for _, k := range loadApprovals(a.Src) {
+			a.approvals.always[k] = true
+		}
+	}
+	return a.approvals.always[kind]
+}
+
+func (a *Agent) allowKind(kind string, persist bool) {
+	a.approvals.mu.Lock()
+	defer a.approvals.mu.Unlock()
+	a.approvals.always[kind] = true
+	if !persist {
+		return
+	}
+	// --dry-run never writes to --src; the choice lasts for this run
+	if a.Overlay != nil {
+		a.Log.Info("approvals: " + kind + " allowed for this run only (--dry-run does not write " + pkg.ApprovalsFile + ")")
+		return
+	}
+	if err := saveApprovals(a.Src, kind); err != nil {
+		a.Log.Info("approvals: could not persist allowlist: " + err.Error())
+	}
+}
+
+// loadApprovals reads the per-repo allowlist; a missing file is empty.
+func loadApprovals(src string) []string {
+	b, err := os.ReadFile(filepath.Join(src, pkg.ApprovalsFile))
+	if err != nil {
+		return nil
+	}
+	var f struct {
+		AlwaysAllow []string `json:"always_allow"`
+	}
+	if json.Unmarshal(b, &f) != nil {
+		return nil
+	}
+	return f.AlwaysAllow
+}
+
+// saveApprovals adds kind to the per-repo allowlist.
+func saveApprovals(src, kind string) error {
+	set := map[string]bool{kind: true}
+	for _, k := range loadApprovals(src) {
+		set[k] = true
+	}
+	var f struct {
+		AlwaysAllow []string `json:"always_allow"`
+	}
+	for k := range set {
+		f.AlwaysAllow = append(f.AlwaysAllow, k)
+	}
+	sort.Strings(f.AlwaysAllow)
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return pkg.NewLockManager().WriteAtomic(filepath.Join(src, pkg.ApprovalsFile), append(b, '\n'))
+}
+
+// approvalPreview renders what the call would do.
+func (a *Agent) approvalPreview(name, rawArgs string) string {
+	var args map[string]any
+	_ = json.Unmarshal([]byte(rawArgs), &args)
+	switch name {
+	case "write_file":
+		p := fmt.Sprint(args["path"])
+		before, _ := a.Ws.ReadFile(filepath.Join(a.Src, filepath.FromSlash(p)))
+		diff := pkg.UnifiedDiff("a/"+p, "b/"+p, before, []byte(fmt.Sprint(args["content"])), 3)
+		if diff == "" {
+			return "(no changes to " + p + ")"
+		}
+		return pkg.ColorDiff(diff)
+	case "delete_path":
+		p := fmt.Sprint(args["path"])
+		var files []string
+		_ = pkg.WalkDir(a.Ws, filepath.Join(a.Src, filepath.FromSlash(p)), func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			rel, _ := filepath.Rel(a.Src, path)
+			files = append(files, filepath.ToSlash(rel))
+			return nil
+		})
+		red := lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+		var sb strings.Builder
+		sb.WriteString(red.Render("delete "+p) + "\n")
+		for i, f := range files {
+			if i == 50 {
+				sb.WriteString(fmt.Sprintf("  ... and %d more\n", len(files)-50))
+				break
+			}
+			sb.WriteString(red.Render("  - "+f) + "\n")
+		}
+		return sb.String()
+	default:
+		cmd := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("214")).Render("$ " + fmt.Sprint(args["cmd"]))
+		return cmd + fmt.Sprintf("\n  permissions=%v\n", args["permissions"])
+	}
+}
+
+// TerminalApprover prompts on a terminal for each gated call.
+type TerminalApprover struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// NewTerminalApprover constructs an Approver reading answers from in.
+// Flow: installed lazily by Review() when no Approver was provided.
+func NewTerminalApprover(in io.Reader, out io.Writer) *TerminalApprover {
+	return &TerminalApprover{in: bufio.NewReader(in), out: out}
+}
+
+// Approve shows the preview and asks approve/deny/edit/always.
+func (t *TerminalApprover) Approve(req ApprovalRequest) (Approval, error) {
+	title := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("213")).Render("\n--- APPROVAL: " + req.Tool + " ---")
+	fmt.Fprintln(t.out, title)
+	fmt.Fprint(t.out, req.Preview)
+	for {
+		if req.Kind == "" {
+			fmt.Fprint(t.out, "[a]pprove  [d]eny  [e]dit > ")
+		} else {
+			fmt.Fprintf(t.out, "[a]pprove  [d]eny  [e]dit  [s] always allow %s (session)  [p] always allow (persist) > ", req.Kind)
+		}
+		line, err := t.in.ReadString('\n')
+		if err != nil && line == "" {
+			return Approval{}, errors.New("no interactive input")
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "a", "y", "yes":
+			return Approval{Allow: true}, nil
+		case "d", "n", "no":
+			fmt.Fprint(t.out, "reason (optional) > ")
+			reason, _ := t.in.ReadString('\n')
+			return Approval{Reason: strings.TrimSpace(reason)}, nil
+		case "e":
+			args, err := t.edit(req)
+			if err != nil {
+				fmt.Fprintln(t.out, "edit failed:", err)
+				continue
+			}
+			return Approval{Allow: true, Args: args}, nil
+		case "s":
+			if req.Kind != "" {
+				return Approval{Allow: true, Always: true}, nil
+			}
+		case "p":
+			if req.Kind != "" {
+				return Approval{Allow: true, Always: true, Persist: true}, nil
+			}
+		}
+	}
+}
+
+// edit lets the user change the call: file content via $EDITOR, other
+// arguments (command line, path) inline.
+func (t *TerminalApprover) edit(req ApprovalRequest) (string, error) {
+	var args map[string]any
+	if err := json.Unmarshal([]byte(req.Args), &args); err != nil {
+		return "", err
+	}
+	switch req.Tool {
+	case "write_file":
+		content, err := editInEditor(fmt.Sprint(args["content"]))
+		if err != nil {
+			return "", err
+		}
+		args["content"] = content
+	case "delete_path":
+		fmt.Fprintf(t.out, "path [%v] > ", args["path"])
+		line, _ := t.in.ReadString('\n')
+		if s := strings.TrimSpace(line); s != "" {
+			args["path"] = s
+		}
+	default:
+		fmt.Fprintf(t.out, "command [%v] > ", args["cmd"])
+		line, _ := t.in.ReadString('\n')
+		if s := strings.TrimSpace(line); s != "" {
+			args["cmd"] = s
+		}
+	}
+	b, err := json.Marshal(args)
+	return string(b), err
+}
+
+// editInEditor opens content in $EDITOR (default vi) and returns the result.
+func editInEditor(content string) (string, error) {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	f, err := os.CreateTemp("", "agent-edit-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return "", err
+	}
+	f.Close()
+	c := exec.Command("sh", "-c", editor+` "$1"`, "editor", f.Name())
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stderr, os.Stderr
+	if err := c.Run(); err != nil {
+		return "", fmt.Errorf("editor: %w", err)
+	}
+	b, err := os.ReadFile(f.Name())
+	return string(b), err
+}
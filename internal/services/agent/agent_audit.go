@@ -0,0 +1,155 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"cds.agents.app/pkg"
+	"github.com/openai/openai-go/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// openAudit creates this run's audit log and records the configuration.
+// Flow: called by Run() before the first model turn.
+// Yields: an error when the log cannot be created; auditing is mandatory once asked for.
+func (a *Agent) openAudit() error {
+	path := a.AuditPath
+	switch {
+	case path == "none":
+		return nil
+	case path == "" && a.Overlay != nil:
+		// --dry-run never writes to --src; an explicit --audit-log still works
+		return nil
+	case path == "":
+		path = a.runPath("audit.jsonl")
+	}
+	l, err := pkg.CreateAuditLog(path)
+	if err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	a.Audit = l
+	a.protectAuditLog(path)
+	policy, _ := yaml.Marshal(a.Policy)
+	return a.Audit.Append("config", map[string]any{
+		"run_id":        a.RunID,
+		"model":         a.Model,
+		"src":           a.Src,
+		"prompt":        a.Redactor.Redact(a.Query),
+		"steps":         a.Steps,
+		"concurrency":   a.Concurrency,
+		"timeout":       a.Timeout.String(),
+		"tool_choice":   a.ToolChoice,
+		"require_tools": a.RequireTools,
+		"dry_run":       a.Overlay != nil,
+		"approve":       a.Approve,
+		"git_commit":    a.GitCommit,
+		"policy_path":   a.PolicyPath,
+		"policy":        string(policy),
+		"sandbox":       pkg.SandboxStatus(a.Policy.SandboxSettings().Mode),
+	})
+}
+
+// protectAuditLog adds the run records and a log kept under --src to this
+// run's paths.protect, whatever the policy file says, so no tool can rewrite
+// or delete the log and the sandbox mounts it read-only.
+// Flow: called by openAudit() once the log exists.
+func (a *Agent) protectAuditLog(path string) {
+	globs := []string{pkg.RunsDir + "/**"}
+	if src, err := filepath.Abs(a.Src); err == nil {
+		if abs, err := filepath.Abs(path); err == nil {
+			if rel, err := filepath.Rel(src, abs); err == nil && filepath.IsLocal(rel) {
+				globs = append(globs, filepath.ToSlash(rel))
+			}
+		}
+	}
+	a.protect(globs...)
+}
+
+// auditRequest records the digest of the request about to be sent.
+// Flow: called by Run() before each completion call.
+func (a *Agent) auditRequest(step int) error {
+	if a.Audit == nil {
+		return nil
+	}
+	body, err := json.Marshal(a.Params)
+	if err != nil {
+		return err
+	}
+	return a.Audit.Append("model_request", map[string]any{
+		"step":           step,
+		"messages":       len(a.Params.Messages),
+		"request_sha256": pkg.SHA256Hex(body),
+	})
+}
+
+// auditResponse records the model's reply, including requested tool calls.
+// Flow: called by Run() after each completion call.
+func (a *Agent) auditResponse(step int, comp *openai.ChatCompletion, elapsed time.Duration) error {
+	if a.Audit == nil {
+		return nil
+	}
+	rec := map[string]any{
+		"step":        step,
+		"id":          comp.ID,
+		"model":       comp.Model,
+		"duration_ms": elapsed.Milliseconds(),
+		"usage": map[string]int64{
+			"prompt_tokens":     comp.Usage.PromptTokens,
+			"completion_tokens": comp.Usage.CompletionTokens,
+		},
+	}
+	if len(comp.Choices) > 0 {
+		msg := comp.Choices[0].Message
+		calls := make([]map[string]string, len(msg.ToolCalls))
+		for i, tc := range msg.ToolCalls {
+			calls[i] = map[string]string{"id": tc.ID, "name": tc.Function.Name, "arguments": a.Redactor.Redact(tc.Function.Arguments)}
+		}
+		rec["finish_reason"] = comp.Choices[0].FinishReason
+		rec["content"] = a.Redactor.Redact(msg.Content)
+		rec["tool_calls"] = calls
+	}
+	return a.Audit.Append("model_response", rec)
+}
+
+// auditTool records one executed (or refused) tool call; result is the text
+// returned to the model.
+// Flow: called by RunPhases() as each call finishes.
+func (a *Agent) auditTool(id, name, args, result string, elapsed time.Duration, err error) {
+	if a.Audit == nil {
+		return
+	}
+	rec := map[string]any{
+		"id":            id,
+		"tool":          name,
+		"arguments":     a.Redactor.Redact(args),
+		"result_sha256": pkg.SHA256Hex([]byte(result)),
+		"result_bytes":  len(result),
+		"duration_ms":   elapsed.Milliseconds(),
+	}
+	if err != nil {
+		rec["error"] = a.Redactor.Redact(err.Error())
+	}
+	if a.slowCall(name, elapsed) {
+		rec["slow"] = true
+	}
+	// a failed write is sticky and surfaces at the next model request
+	_ = a.Audit.Append("tool_call", rec)
+}
+
+// closeAudit ends the log with the run's outcome.
+// Flow: deferred by Run(), after finish().
+func (a *Agent) closeAudit(runErr error) error {
+	if a.Audit == nil {
+		return nil
+	}
+	status := "completed"
+	if runErr != nil {
+		status = a.Redactor.Redact(runErr.Error())
+	}
+	if err := a.Audit.Close(map[string]any{"status": status, "steps": a.stepsUsed, "usage": a.Quotas.Usage()}); err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	return nil
+}
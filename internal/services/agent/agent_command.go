@@ -0,0 +1,309 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"cds.agents.app/pkg"
+)
+
+// runCommand executes the run_command tool after classifying the command line.
+// Flow: called by Tooling() for run_command; call names the spilled log.
+// Yields: a header with exit code, duration and log path, then head and tail
+// of the output, or an error explaining the refusal.
+func (a *Agent) runCommand(ctx context.Context, args map[string]any, call string) (string, error) {
+	cmdline := argString(args, "cmd")
+	to := argString(args, "timeout") // e.g., "60s"
+	if cmdline == "" {
+		return "", errors.New("cmd required")
+	}
+	le := a.Log.Start("run_command", cmdline)
+	if err := checkDeclaredEffects(args, cmdline); err != nil {
+		le.Error(err)
+		return "", err
+	}
+
+	// prepare context with the policy's timeout limits; cancelling the run
+	// (Ctrl-C) kills the process group too
+	ctx, cancel := context.WithTimeout(ctx, a.Policy.Timeout(to))
+	defer cancel()
+
+	c, limits, cleanup, err := a.prepareCommand(ctx, cmdline, argString(args, "permissions"))
+	if err != nil {
+		le.Error(err)
+		return "", err
+	}
+	defer cleanup()
+
+	// the model sees the start and (mostly) the end of the output; the slack
+	// lets redaction see secrets that straddle a cut
+	limit := a.Policy.OutputLimit()
+	head := limit / 4
+	capture, err := pkg.NewOutputCapture(head+outputSlack, limit-head+outputSlack, maxLogBytes)
+	if err != nil {
+		le.Error(err)
+		return "", err
+	}
+	defer capture.Close()
+	c.Stdout, c.Stderr = capture.Stdout(), capture.Stderr()
+	start := time.Now()
+	err = c.Run()
+	elapsed := time.Since(start)
+	timedOut := ctx.Err() == context.DeadlineExceeded
+	interrupted := ctx.Err() == context.Canceled
+
+	exit := -1
+	if c.ProcessState != nil {
+		exit = c.ProcessState.ExitCode()
+	}
+	total := capture.Buf.Total()
+	fields := fmt.Sprintf("exit_code=%d duration=%s output_bytes=%d", exit, elapsed.Round(time.Millisecond), total)
+	text, spilled := a.commandText(capture, limit, head)
+	if spilled {
+		// complete output goes to a log the model can read_file; not in --dry-run, which never writes to --src
+		if a.Overlay != nil {
+			text = strings.Replace(text, "{log}", "full output is not saved in --dry-run", 1)
+		} else {
+			logPath := a.runPath("outputs", call+".log")
+			rel, _ := filepath.Rel(a.Src, logPath)
+			rel = filepath.ToSlash(rel)
+			if serr := capture.Save(logPath, a.Redactor.Redact); serr != nil {
+				text = strings.Replace(text, "{log}", "full output could not be saved: "+serr.Error(), 1)
+			} else {
+				fields += " log=" + rel
+				text = strings.Replace(text, "{log}", "full stdout and stderr in "+rel, 1)
+			}
+		}
+	}
+	text = fields + "\n" + text
+	if timedOut {
+		le.Error(errors.New("timeout"))
+		return text + fmt.Sprintf("\n(timeout: %s wall-clock limit hit, %s)", a.Policy.Timeout(to), killedWhat()), errors.New("command timed out")
+	}
+	if interrupted {
+		le.Error(errors.New("interrupted"))
+		return text + "\n(interrupted: the run was cancelled, " + killedWhat() + ")", errors.New("command interrupted")
+	}
+	if err != nil {
+		if hit := pkg.LimitsHit(limits, c.ProcessState, text); len(hit) > 0 {
+			text += "\n(limit hit: " + strings.Join(hit, ", ") + ")"
+		}
+		le.Error(err)
+		// return both output and error for visibility
+		return text, err
+	}
+	le.Success("ok")
+	return text, nil
+}
+
+// checkDeclaredEffects holds a command to the writes it declared, which
+// PlanPhases() trusted when running it alongside other calls.
+func checkDeclaredEffects(args map[string]any, cmdline string) error {
+	raw, _ := json.Marshal(args)
+	eff, _ := pkg.InferCommandEffects(string(raw))
+	if !eff.Declared {
+		return nil
+	}
+	an, err := pkg.AnalyzeCommand(cmdline)
+	if err != nil {
+		return err
+	}
+	return pkg.CheckDeclaredWrites(an, eff.Writes)
+}
+
+// commandText fits captured output into limit bytes: all of it when it fits,
+// otherwise head bytes of the start and the rest from the end around a
+// marker holding a {log} placeholder.
+func (a *Agent) commandText(capture *pkg.OutputCapture, limit, head int) (string, bool) {
+	h, t, omitted := capture.Buf.Parts()
+	h, t = a.redactCommandSecrets(h), a.redactCommandSecrets(t)
+	if omitted == 0 && len(h)+len(t) <= limit {
+		return h + t, false
+	}
+	if omitted == 0 {
+		// everything was captured; cut the joined text instead
+		full := h + t
+		omitted = int64(len(full) - limit)
+		h, t = full[:head], full[len(full)-(limit-head):]
+	} else {
+		omitted += int64(len(h)-head) + int64(max(0, len(t)-(limit-head)))
+		h, t = h[:min(head, len(h))], t[max(0, len(t)-(limit-head)):]
+	}
+	return fmt.Sprintf("%s\n...[%d bytes omitted: output limit of %d bytes hit; {log}]...\n%s", pkg.TrimUTF8(h), omitted, limit, pkg.TrimUTF8(t)), true
+}
+
+// prepareCommand classifies a command line and builds its sandboxed process.
+// Flow: shared by runCommand and start_process; ctx bounds the process lifetime.
+// Yields: the unstarted command, its process limits and a cleanup for its TMPDIR.
+func (a *Agent) prepareCommand(ctx context.Context, cmdline, perms string) (*exec.Cmd, pkg.ProcessLimits, func(), error) {
+	// permissions parsing (also enforced by the kernel sandbox where supported)
+	allowR := strings.Contains(perms, "r")
+	allowW := strings.Contains(perms, "w")
+	allowX := strings.Contains(perms, "x")
+	none := pkg.ProcessLimits{}
+
+	// static analysis of the parsed command (pipelines, subshells, substitutions, redirections)
+	an, err := pkg.AnalyzeCommand(cmdline)
+	if err != nil {
+		return nil, none, nil, err
+	}
+	if err := checkCommand(an, allowW, allowX); err != nil {
+		return nil, none, nil, err
+	}
+	// a visible write to a directory (rm -rf, mv) must not take protected paths with it
+	for _, w := range an.WritePaths {
+		abs := w
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(a.Src, w)
+		}
+		if rel := relSlash(a.Src, abs); rel == "." || !filepath.IsLocal(rel) {
+			continue // unattributed writes and paths outside --src are left to the sandbox
+		}
+		if fi, err := a.Ws.Stat(abs); err == nil && fi.IsDir() {
+			if err := a.checkProtectedTree(a.Src, abs); err != nil {
+				return nil, none, nil, err
+			}
+		}
+	}
+
+	// commands run on the real disk: they would bypass an overlay or miss an in-memory tree
+	switch a.Ws.(type) {
+	case *pkg.OSWorkspace:
+	case *pkg.OverlayWorkspace:
+		if an.Writes || len(an.ExecPaths) > 0 {
+			return nil, none, nil, errors.New("dry-run: run_command is restricted to read-only commands")
+		}
+	default:
+		return nil, none, nil, errors.New("run_command requires a disk-backed workspace")
+	}
+
+	if err := a.Quotas.Command(); err != nil {
+		return nil, none, nil, err
+	}
+	if allowW {
+		a.cmdWrites.Add(1)
+	}
+
+	// execute via shell, confined to --src with the requested permissions
+	src, err := filepath.Abs(a.Src)
+	if err != nil {
+		return nil, none, nil, err
+	}
+	tmp, err := os.MkdirTemp("", "agent-cmd-*")
+	if err != nil {
+		return nil, none, nil, err
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+	rules := a.Policy.SandboxSettings()
+	spec := pkg.SandboxSpec{
+		Dir:        src,
+		Read:       allowR,
+		Write:      allowW && a.Overlay == nil,
+		Exec:       allowX,
+		Network:    rules.Network,
+		WritePaths: []string{tmp},
+		Limits:     a.Policy.ProcessLimits(),
+	}
+	for _, p := range rules.Read {
+		spec.ReadPaths = append(spec.ReadPaths, pkg.ExpandHome(p))
+	}
+	for _, p := range rules.Write {
+		spec.WritePaths = append(spec.WritePaths, pkg.ExpandHome(p))
+	}
+	// protected paths are mounted read-only, so writes the parser cannot see still fail
+	if spec.Write {
+		// the agent's directory must exist to be mounted, or a command could
+		// create a policy or approvals file for the next run; while one of
+		// those is missing the whole directory is mounted in its place
+		agentDir := a.Policy.CheckProtected(pkg.AgentDir) != nil
+		if agentDir || agentStateMissing(src) {
+			if err := os.MkdirAll(filepath.Join(src, pkg.AgentDir), 0o755); err != nil {
+				cleanup()
+				return nil, none, nil, err
+			}
+		}
+		if !agentDir && agentStateMissing(src) {
+			if abs, err := filepath.Abs(filepath.Join(src, pkg.AgentDir)); err == nil {
+				spec.ReadOnlyPaths = append(spec.ReadOnlyPaths, abs)
+			}
+		}
+		for _, p := range a.protectedUnder(a.Src, a.Src) {
+			if abs, err := filepath.Abs(p); err == nil {
+				spec.ReadOnlyPaths = append(spec.ReadOnlyPaths, abs)
+			}
+		}
+	}
+	// denied paths are masked, so reads the parser cannot see find nothing
+	for _, p := range a.deniedUnder(a.Src, a.Src) {
+		if abs, err := filepath.Abs(p); err == nil {
+			spec.HiddenPaths = append(spec.HiddenPaths, abs)
+		}
+	}
+	// only allowlisted variables reach the command (no API keys or CI secrets)
+	env := append(pkg.ScrubEnv(os.Environ(), a.Policy.EnvSettings().Allow), "TMPDIR="+tmp)
+	c, warn, err := pkg.SandboxCommand(ctx, rules.Mode, spec, env, cmdline)
+	if err != nil {
+		cleanup()
+		return nil, none, nil, err
+	}
+	if warn != "" {
+		a.sandboxWarn.Do(func() { a.Log.Warn(warn) })
+	}
+	return c, spec.Limits, cleanup, nil
+}
+
+const (
+	// outputSlack is captured beyond the output limit so redaction sees whole tokens.
+	outputSlack = 4096
+	// maxLogBytes caps each stream of a spilled output log.
+	maxLogBytes = 16 << 20
+)
+
+// checkCommand applies r/w/x permissions to an analysis; programs are
+// checked against the policy by Tooling().
+func checkCommand(an *pkg.CommandAnalysis, allowW, allowX bool) error {
+	for _, call := range an.Calls {
+		if filepath.Base(call.Program) == "rm" && slices.ContainsFunc(call.Args, isRootPath) {
+			return errors.New("command would delete the filesystem root or home directory")
+		}
+	}
+	if an.Writes && !allowW {
+		return fmt.Errorf("write permissions required (use permissions contains 'w'): %s", strings.Join(an.WriteReasons, ", "))
+	}
+	// disallow executing arbitrary binaries, scripts or inline interpreter code without x
+	if len(an.ExecPaths) > 0 && !allowX {
+		return fmt.Errorf("execute permissions required (include 'x') for running binaries by path: %s", strings.Join(an.ExecPaths, ", "))
+	}
+	return nil
+}
+
+// isRootPath matches "/", "/*", "~" and "~/" style targets.
+func isRootPath(p string) bool {
+	t := strings.TrimRight(p, "/*")
+	return (t == "" && strings.HasPrefix(p, "/")) || t == "~"
+}
+
+// argString reads a string tool argument; missing or null values are empty.
+func argString(args map[string]any, key string) string {
+	v, ok := args[key]
+	if !ok || v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// killedWhat names what stopping a command kills on this platform.
+func killedWhat() string {
+	if pkg.ProcessGroupKill {
+		return "process group killed"
+	}
+	return "process killed; processes it started may still be running"
+}
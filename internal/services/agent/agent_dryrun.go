@@ -0,0 +1,26 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+)
+
+// finishDryRun renders staged overlay changes as a unified diff.
+// Flow: deferred by Run() when --dry-run is set.
+// Yields: none; prints the patch or writes it to OutputPatch.
+func (a *Agent) finishDryRun() error {
+	patch := a.Overlay.Patch()
+	if a.OutputPatch != "" {
+		if err := os.WriteFile(a.OutputPatch, []byte(patch), 0o644); err != nil {
+			return fmt.Errorf("write patch: %w", err)
+		}
+		a.Log.Info(fmt.Sprintf("Dry run: %d changed file(s), patch written to %s", len(a.Overlay.Changes()), a.OutputPatch))
+		return nil
+	}
+	if patch == "" {
+		a.Log.Info("Dry run: no changes staged")
+		return nil
+	}
+	os.Stdout.WriteString(patch)
+	return nil
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"cds.agents.app/pkg"
+	"github.com/openai/openai-go/v2"
+)
+
+// maxCommitDiff bounds the staged diff sent to the model for a commit message.
+const maxCommitDiff = 12000
+
+// gitStart verifies the tree and creates the run branch.
+// Flow: called by Run() after printConfig when --git-commit is set.
+// Yields: none; returns an error to refuse starting.
+func (a *Agent) gitStart() error {
+	if a.Overlay != nil {
+		return errors.New("--git-commit cannot be combined with --dry-run")
+	}
+	g := pkg.Git{Dir: a.Src}
+	if !g.IsRepo() {
+		return fmt.Errorf("--git-commit: %s is not inside a git work tree", a.Src)
+	}
+	dirty, err := g.DirtyPaths()
+	if err != nil {
+		return err
+	}
+	if len(dirty) > 0 && !a.AllowDirty {
+		return errors.New("--git-commit: working tree has uncommitted changes (commit/stash them or pass --allow-dirty)")
+	}
+	if len(dirty) > 0 {
+		a.gitSkip = dirty
+		a.Log.Warn(fmt.Sprintf("git: %d file(s) with uncommitted changes are left out of the run's commits, including any edits the run makes to them", len(dirty)))
+	}
+	branch := pkg.BranchName(a.Query, time.Now())
+	if err := g.CreateBranch(branch); err != nil {
+		return err
+	}
+	a.Log.Info("  Git branch : " + branch)
+	return nil
+}
+
+// gitCommit stages the run's changes (everything but the files that were
+// already dirty) and commits them with a model-written message;
+// ctx is the run's, so an interrupted run commits with the fallback message.
+// Flow: after each turn (--commit-each-turn) and once when Run() finishes.
+// Yields: none; no-op when nothing changed.
+func (a *Agent) gitCommit(ctx context.Context, steps int, status string) error {
+	g := pkg.Git{Dir: a.Src}
+	diff, err := g.StageAll(a.gitSkip...)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(diff) == "" {
+		return nil
+	}
+	subject := a.commitMessage(ctx, diff)
+	prompt := strings.Join(strings.Fields(a.Query), " ")
+	if len(prompt) > 200 {
+		prompt = prompt[:200] + "..."
+	}
+	trailers := []string{
+		"Agent-Model: " + a.Model,
+		fmt.Sprintf("Agent-Steps: %d", steps),
+		"Agent-Prompt: " + prompt,
+	}
+	if status != "" {
+		trailers = append(trailers, "Agent-Status: "+status)
+	}
+	if err := g.Commit(subject+"\n\n"+strings.Join(trailers, "\n")+"\n", a.gitSkip...); err != nil {
+		return err
+	}
+	a.Log.Info("git: committed " + strings.SplitN(subject, "\n", 2)[0])
+	return nil
+}
+
+// commitMessage asks the model to summarize a staged diff.
+// Falls back to a message derived from the task prompt, without calling the
+// model once ctx is cancelled (Ctrl-C).
+func (a *Agent) commitMessage(ctx context.Context, diff string) string {
+	fallback := "agent: " + strings.SplitN(strings.TrimSpace(a.Query), "\n", 2)[0]
+	if len(fallback) > 72 {
+		fallback = fallback[:72]
+	}
+	if ctx.Err() != nil {
+		return fallback
+	}
+	diff = a.Redactor.Redact(diff)
+	if len(diff) > maxCommitDiff {
+		diff = diff[:maxCommitDiff] + "\n...[diff truncated]"
+	}
+	ctx, cancel := context.WithTimeout(ctx, a.Timeout)
+	defer cancel()
+	comp, err := a.Client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Model: openai.ChatModel(a.Model),
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage("Write a git commit message for the staged diff: an imperative subject line under 72 characters, optionally followed by a blank line and a short body. Output only the message."),
+			openai.UserMessage("Task: " + a.Query + "\n\nStaged diff:\n" + diff),
+		},
+	})
+	if err != nil || len(comp.Choices) == 0 {
+		return fallback
+	}
+	msg := strings.TrimSpace(strings.Trim(strings.TrimSpace(comp.Choices[0].Message.Content), "`"))
+	if msg == "" {
+		return fallback
+	}
+	return msg
+}
@@ -3,8 +3,13 @@ package agent
 import (
 	"container/list"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"cds.agents.app/pkg"
 	"github.com/openai/openai-go/v2"
@@ -15,80 +20,95 @@ import (
 // Flow: called by Run() after extracting tool calls.
 // Yields: none; returns phase layers for execution.
 func (a *Agent) PlanPhases(root string, calls []pkg.ToolCallLite) ([][]int, error) {
+	return a.Plan(root, calls).Phases, nil
+}
+
+// Plan computes the ordering constraints between one turn's calls, with the
+// reason for each, and layers the calls into phases.
+// Flow: called by PlanPhases(), Run() (for --plan-graph) and `agent plan`.
+// Yields: none; fills the calls' planning fields.
+func (a *Agent) Plan(root string, calls []pkg.ToolCallLite) pkg.Plan {
 	// Fill in normalized paths for planning
 	for i := range calls {
 		p, d := pkg.AnalyzeLite(root, calls[i].FuncName, calls[i].FuncArgs)
-		calls[i].PathAbs, calls[i].DirAbs = p, d
+		calls[i].PathAbs, calls[i].DirAbs, calls[i].After = p, d, nil
+		switch calls[i].FuncName {
+		case "run_command":
+			// declared or inferred effects; unknown ones make the call a barrier
+			eff, ok := pkg.InferCommandEffects(calls[i].FuncArgs)
+			calls[i].Reads, calls[i].Writes, calls[i].Barrier = absPaths(root, eff.Reads), absPaths(root, eff.Writes), !ok
+		case "start_process":
+			calls[i].Barrier = true
+		}
+		// compare the files the tools will touch, not the spellings: two
+		// paths through an in-tree symlink name the same file
+		calls[i].PathAbs = a.resolvePlanPath(root, calls[i].PathAbs, calls[i].FuncName != "delete_path")
+		calls[i].DirAbs = a.resolvePlanPath(root, calls[i].DirAbs, true)
+		for j, r := range calls[i].Reads {
+			calls[i].Reads[j] = a.resolvePlanPath(root, r, true)
+		}
+		for j, w := range calls[i].Writes {
+			calls[i].Writes[j] = a.resolvePlanPath(root, w, true)
+		}
 	}
 
+	plan := pkg.Plan{Calls: calls}
 	adj := make([][]int, len(calls))
 	indeg := make([]int, len(calls))
-	addEdge := func(u, v int) { // u -> v
+	edges := map[[2]int]int{} // (u, v) -> index in plan.Edges
+	// u -> v; a second reason for the same pair joins the first
+	addEdge := func(u, v int, reason string) {
+		if k, ok := edges[[2]int{u, v}]; ok {
+			plan.Edges[k].Reason += "; " + reason
+			return
+		}
+		edges[[2]int{u, v}] = len(plan.Edges)
+		plan.Edges = append(plan.Edges, pkg.PlanEdge{From: u, To: v, Reason: reason})
 		adj[u] = append(adj[u], v)
 		indeg[v]++
+		calls[v].After = append(calls[v].After, u)
 	}
 
-	// Group by file path and by directory (for list_dir)
-	byPath := map[string][]int{}
-	byDirList := map[string][]int{}
-	for i, c := range calls {
-		if c.PathAbs != "" {
-			byPath[c.PathAbs] = append(byPath[c.PathAbs], i) // preserves input order
-		}
-		if c.FuncName == "list_dir" && c.DirAbs != "" {
-			byDirList[c.DirAbs] = append(byDirList[c.DirAbs], i)
-		}
-	}
-
-	// Same-file ordering
-	for _, idxs := range byPath {
-		var writes, reads, deletes []int
-		for _, i := range idxs {
-			switch calls[i].FuncName {
-			case "write_file":
-				writes = append(writes, i)
-			case "read_file":
-				reads = append(reads, i)
-			case "delete_path":
-				deletes = append(deletes, i)
-			}
-		}
-
-		// Deterministic ordering among multiple writes on the same file:
-		for k := 0; k+1 < len(writes); k++ {
-			addEdge(writes[k], writes[k+1])
-		}
-
-		// writes happen before reads on the same file
-		for _, w := range writes {
-			for _, r := range reads {
-				addEdge(w, r)
-			}
-		}
-		// everything (reads/writes) happens before delete on the same file
-		for _, i := range idxs {
-			for _, d := range deletes {
-				if i != d {
-					addEdge(i, d)
+	// Calls whose paths nest (equal, ancestor or descendant) and where at
+	// least one changes the tree keep the order the model emitted them in:
+	// deleting a/b comes before or after reading a/b/c.txt as written, and a
+	// listing of a sees exactly the writes that precede it. A barrier (a
+	// command with unknown effects) is ordered against every other call.
+	for j := range calls {
+		for i := 0; i < j; i++ {
+			switch {
+			case calls[i].Barrier:
+				addEdge(i, j, barrierReason(calls[i]))
+			case calls[j].Barrier:
+				addEdge(i, j, barrierReason(calls[j]))
+			default:
+				if x, y, ok := conflict(pathAccess(calls[i]), pathAccess(calls[j])); ok {
+					addEdge(i, j, "paths nest: "+x.describe(root)+" and "+y.describe(root))
 				}
 			}
 		}
 	}
 
-	// Directory listings should reflect writes/deletes in that directory
-	for dir, listers := range byDirList {
-		for i, c := range calls {
-			if c.PathAbs == "" {
-				continue
-			}
-			if filepath.Dir(c.PathAbs) != dir {
-				continue
+	// Calls on the same background process keep their emitted order
+	byProc := map[string][]int{}
+	var procs []string
+	for i, c := range calls {
+		switch c.FuncName {
+		case "read_process_output", "write_process_stdin", "stop_process":
+			var args struct {
+				ID string `json:"id"`
 			}
-			if c.FuncName == "write_file" || c.FuncName == "delete_path" {
-				for _, ld := range listers {
-					addEdge(i, ld)
-				}
+			_ = json.Unmarshal([]byte(c.FuncArgs), &args)
+			if _, ok := byProc[args.ID]; !ok {
+				procs = append(procs, args.ID)
 			}
+			byProc[args.ID] = append(byProc[args.ID], i)
+		}
+	}
+	for _, id := range procs {
+		idxs := byProc[id]
+		for k := 0; k+1 < len(idxs); k++ {
+			addEdge(idxs[k], idxs[k+1], "same process "+id)
 		}
 	}
 
@@ -130,20 +150,131 @@ func (a *Agent) PlanPhases(root string, calls []pkg.ToolCallLite) ([][]int, erro
 		for i := range calls {
 			seq[i] = i
 		}
-		return [][]int{seq}, nil
+		plan.Phases, plan.Cyclic = [][]int{seq}, true
+		return plan
+	}
+	plan.Phases = phases
+	return plan
+}
+
+// barrierReason explains why c is ordered against every other call.
+func barrierReason(c pkg.ToolCallLite) string {
+	if c.FuncName == "start_process" {
+		return "barrier: start_process"
+	}
+	return "barrier: " + c.FuncName + " with undeclared effects"
+}
+
+// access is a subtree a call observes or changes.
+type access struct {
+	path  string
+	write bool
+}
+
+// pathAccess lists the subtrees a call touches. Reads see one file;
+// listings see their whole directory (a write below it can add an entry);
+// write_file may create parent directories, which the overlap with any
+// listing above it covers; delete_path removes the subtree; commands touch
+// their declared or inferred reads and writes.
+func pathAccess(c pkg.ToolCallLite) []access {
+	var out []access
+	switch c.FuncName {
+	case "read_file":
+		out = append(out, access{c.PathAbs, false})
+	case "write_file", "delete_path":
+		out = append(out, access{c.PathAbs, true})
+	case "list_dir", "list_dir_recursive":
+		out = append(out, access{c.DirAbs, false})
+	case "run_command":
+		for _, p := range c.Reads {
+			out = append(out, access{p, false})
+		}
+		for _, p := range c.Writes {
+			out = append(out, access{p, true})
+		}
+	}
+	return slices.DeleteFunc(out, func(x access) bool { return x.path == "" })
+}
+
+// conflict finds a pair of two calls' accesses that nest with at least one write.
+func conflict(a, b []access) (access, access, bool) {
+	for _, x := range a {
+		for _, y := range b {
+			if (x.write || y.write) && pkg.PathsOverlap(x.path, y.path) {
+				return x, y, true
+			}
+		}
+	}
+	return access{}, access{}, false
+}
+
+// describe renders an access relative to root, e.g. "a/b (write)".
+func (x access) describe(root string) string {
+	rel, err := filepath.Rel(root, x.path)
+	if err != nil {
+		rel = x.path
+	}
+	if x.write {
+		return filepath.ToSlash(rel) + " (write)"
+	}
+	return filepath.ToSlash(rel) + " (read)"
+}
+
+// absPaths joins relative slash paths onto root.
+func absPaths(root string, rels []string) []string {
+	out := make([]string, len(rels))
+	for i, r := range rels {
+		out[i] = filepath.Join(root, filepath.FromSlash(r))
+	}
+	return out
+}
+
+// resolvePlanPath resolves an absolute path under root through in-tree
+// symlinks the way the tools will (see Tooling). Paths it cannot resolve,
+// e.g. outside root or refused by paths.symlinks, stay lexical; the call
+// fails at execution anyway.
+func (a *Agent) resolvePlanPath(root, abs string, followLast bool) string {
+	if abs == "" {
+		return abs
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return abs
+	}
+	resolved, err := pkg.ResolveInRoot(root, filepath.ToSlash(rel), a.Policy.SymlinkMode(), followLast)
+	if err != nil {
+		return abs
 	}
-	return phases, nil
+	return resolved
 }
 
 // RunPhases executes phases sequentially, tool calls concurrently per phase.
-// Flow: invoked by Run() after planning.
+// Flow: wrapper for callers without a run context (tests, tools).
 // Yields: appends ToolMessage results for each call; no final user text here.
 func (a *Agent) RunPhases(toolCalls []pkg.ToolCallLite, phases [][]int, msg openai.ChatCompletionMessage) error {
+	return a.RunPhasesContext(context.Background(), toolCalls, phases, msg)
+}
+
+// RunPhasesContext executes phases sequentially, tool calls concurrently
+// per phase. Once ctx is cancelled, calls already running finish (commands
+// are killed), and calls not yet started are skipped, so every call still
+// gets a result.
+// Flow: invoked by Run() after planning.
+// Yields: appends ToolMessage results for each call; no final user text here.
+func (a *Agent) RunPhasesContext(ctx context.Context, toolCalls []pkg.ToolCallLite, phases [][]int, msg openai.ChatCompletionMessage) error {
 
 	// Collect results for each tool call index
-	type toolResult struct{ id, out string }
+	type toolResult struct {
+		id, out string
+		failed  bool
+	}
 	results := make([]toolResult, len(toolCalls))
 
+	// blame[i] names the failed call that i is (or, when skipped, stands in
+	// for); aborted is set once a failure stops the turn (--continue-on-error=false)
+	blame := make([]string, len(toolCalls))
+	aborted := ""
+
 	// ===================== PHASE EXECUTION =====================
 	//
 	// Mental model:
@@ -162,35 +293,68 @@ func (a *Agent) RunPhases(toolCalls []pkg.ToolCallLite, phases [][]int, msg open
 	//   Phase 1: run (1) and (4) in parallel
 	//   Phase 2: after Phase 1 finishes, run (2) and (3) in parallel
 	//
+	// Calls share the run-wide Scheduler: each takes its tool's weight in
+	// --concurrency slots (run_command counts double by default), and
+	// scheduling.max_concurrent caps a tool's calls running at once.
+	//
 	// Per-path locks (RWMutex) + atomic writes make it safe inside a phase:
 	//   - read_file / list_dir use RLock (shared)
 	//   - write_file / delete_path use Lock (exclusive)
 	// ===========================================================
 	for _, layer := range phases {
-		g, gctx := errgroup.WithContext(context.Background())
-		sem := make(chan struct{}, a.Concurrency) // bounded worker pool for this phase
+		// Calls downstream of a failure are skipped rather than run on stale state.
+		denied := map[int]string{}
+		for _, i := range layer {
+			if ctx.Err() != nil {
+				denied[i] = interruptedSkip
+				continue
+			}
+			if reason := a.skipReason(toolCalls, i, blame, aborted); reason != "" {
+				denied[i] = reason
+				a.Log.Warn(pkg.CallLabel(i, toolCalls[i]) + ": " + reason)
+			}
+		}
 
+		// Approval gate (--approve): ask sequentially before the phase runs in parallel.
+		args := map[int]string{}
 		for _, i := range layer {
-			i := i // capture
-			// tc := toolCalls[i]
+			if _, ok := denied[i]; ok {
+				continue
+			}
+			raw, err := a.Review(msg.ToolCalls[i].Function.Name, msg.ToolCalls[i].Function.Arguments)
+			if err != nil {
+				denied[i] = "DENIED: " + err.Error()
+				continue
+			}
+			args[i] = raw
+		}
 
-			g.Go(func() error {
-				// acquire a worker slot
-				select {
-				case sem <- struct{}{}:
-					defer func() { <-sem }()
-				case <-gctx.Done():
-					return gctx.Err()
-				}
+		g, gctx := errgroup.WithContext(ctx)
 
-				// Run tool via original SDK messages ToolCalls (same index)
-				raw := msg.ToolCalls[i].Function.Arguments
+		for _, i := range layer {
+			g.Go(func() error {
 				name := msg.ToolCalls[i].Function.Name
-				out, err := a.Tooling(a.Src, name, raw)
+				if reason, ok := denied[i]; ok {
+					results[i] = toolResult{id: msg.ToolCalls[i].ID, out: reason, failed: !strings.HasPrefix(reason, "skipped: ")}
+					a.auditTool(msg.ToolCalls[i].ID, name, msg.ToolCalls[i].Function.Arguments, a.Redactor.Redact(reason), 0, errors.New(reason))
+					return nil
+				}
+				// acquire the call's weight in the run-wide pool
+				release, err := a.Scheduler.Acquire(gctx, name)
 				if err != nil {
-					out = "ERROR: " + err.Error()
+					results[i] = toolResult{id: msg.ToolCalls[i].ID, out: interruptedSkip}
+					a.auditTool(msg.ToolCalls[i].ID, name, msg.ToolCalls[i].Function.Arguments, interruptedSkip, 0, errors.New(interruptedSkip))
+					return nil
 				}
-				results[i] = toolResult{id: msg.ToolCalls[i].ID, out: out}
+				defer release()
+
+				// Run tool via original SDK message ToolCalls (same index), with approved args
+				raw := args[i]
+				start := time.Now()
+				out, err := a.ToolingContext(gctx, a.Src, msg.ToolCalls[i].ID, name, raw)
+				out = a.withQuota(name, a.toolResult(name, raw, out, err), err)
+				results[i] = toolResult{id: msg.ToolCalls[i].ID, out: out, failed: err != nil}
+				a.auditTool(msg.ToolCalls[i].ID, name, raw, a.Redactor.Redact(out), time.Since(start), err)
 				return nil
 			})
 		}
@@ -198,12 +362,61 @@ func (a *Agent) RunPhases(toolCalls []pkg.ToolCallLite, phases [][]int, msg open
 		if err := g.Wait(); err != nil {
 			return err
 		}
+		for _, i := range layer {
+			if results[i].failed {
+				blame[i] = failedCall(msg.ToolCalls[i].ID, i, toolCalls[i])
+				if a.StopOnError && aborted == "" {
+					aborted = blame[i]
+				}
+			}
+		}
 	}
 	// ===========================================================
 
 	// Feed ALL tool results for this assistant turn back to the model.
 	for i := range toolCalls {
-		a.Params.Messages = append(a.Params.Messages, openai.ToolMessage(results[i].out, results[i].id))
+		a.Params.Messages = append(a.Params.Messages, openai.ToolMessage(a.Redactor.Redact(results[i].out), results[i].id))
 	}
 	return errors.New("stopped: exceeded max steps")
 }
+
+// interruptedSkip is the result of calls a cancelled run never started.
+const interruptedSkip = "skipped: the run was interrupted before this call started"
+
+// skipReason says why call i must not run: the turn was aborted, or a call
+// it waits for failed (or was skipped) after possibly changing what i would
+// see. Failed reads do not propagate; the calls after them see the same tree.
+// Flow: called by RunPhases() before each phase; records blame for skips.
+// Yields: "" when i should run.
+func (a *Agent) skipReason(calls []pkg.ToolCallLite, i int, blame []string, aborted string) string {
+	if aborted != "" {
+		blame[i] = aborted
+		return "skipped: turn aborted after call " + aborted + " failed"
+	}
+	for _, u := range calls[i].After {
+		if blame[u] != "" && mutates(calls[u]) {
+			blame[i] = blame[u]
+			return "skipped: depends on failed call " + blame[u]
+		}
+	}
+	return ""
+}
+
+// mutates reports whether a call may change files or process state.
+func mutates(c pkg.ToolCallLite) bool {
+	switch c.FuncName {
+	case "write_file", "delete_path", "start_process", "write_process_stdin", "stop_process":
+		return true
+	case "run_command":
+		return c.Barrier || len(c.Writes) > 0
+	}
+	return false
+}
+
+// failedCall names a call for skip messages, e.g. "call_1 (write_file a.txt)".
+func failedCall(id string, i int, c pkg.ToolCallLite) string {
+	if id == "" {
+		id = fmt.Sprintf("#%d", i)
+	}
+	return id + " (" + pkg.CallSummary(c) + ")"
+}
@@ -0,0 +1,27 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+
+	"cds.agents.app/pkg"
+)
+
+// writePlanGraph adds a turn's plan to the --plan-graph file, rewriting it
+// so it always holds one complete graph of every turn so far.
+// Flow: called by Run() after planning each turn.
+// Yields: an error when the file cannot be written.
+func (a *Agent) writePlanGraph(plan pkg.Plan) error {
+	if a.PlanGraph == "" {
+		return nil
+	}
+	format, err := pkg.PlanGraphFormat(a.PlanGraph)
+	if err != nil {
+		return err
+	}
+	a.plans = append(a.plans, plan)
+	if err := os.WriteFile(a.PlanGraph, []byte(pkg.RenderPlans(format, a.plans)), 0o644); err != nil {
+		return fmt.Errorf("plan graph: %w", err)
+	}
+	return nil
+}
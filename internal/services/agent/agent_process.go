@@ -0,0 +1,180 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"cds.agents.app/pkg"
+)
+
+const (
+	// maxProcesses bounds concurrently running start_process commands.
+	maxProcesses = 4
+	// maxOutputWait caps how long read_process_output may block.
+	maxOutputWait = 30 * time.Second
+)
+
+// startProcess runs a command in the background under the run_command sandbox.
+// Flow: called by Tooling() for start_process.
+// Yields: the process id plus any output printed in its first second.
+func (a *Agent) startProcess(args map[string]any) (string, error) {
+	cmdline := argString(args, "cmd")
+	if cmdline == "" {
+		return "", errors.New("cmd required")
+	}
+	le := a.Log.Start("start_process", cmdline)
+	ctx, cancel := context.WithCancel(context.Background())
+	c, _, cleanup, err := a.prepareCommand(ctx, cmdline, argString(args, "permissions"))
+	if err != nil {
+		cancel()
+		le.Error(err)
+		return "", err
+	}
+	p, err := a.Procs.Start(cmdline, c, cancel, cleanup)
+	if err != nil {
+		cancel()
+		cleanup()
+		le.Error(err)
+		return "", err
+	}
+	// early output shows startup failures without another round trip
+	p.Wait(time.Second)
+	le.Success(p.ID)
+	return a.processOutput(p, 0), nil
+}
+
+// readProcessOutput returns output written since a cursor; cancelling ctx
+// ends the wait early.
+// Flow: called by Tooling() for read_process_output.
+func (a *Agent) readProcessOutput(ctx context.Context, args map[string]any) (string, error) {
+	p, err := a.Procs.Get(argString(args, "id"))
+	if err != nil {
+		return "", err
+	}
+	cursor := argInt(args, "cursor")
+	if d, err := time.ParseDuration(argString(args, "wait")); err == nil && d > 0 {
+		p.WaitOutput(ctx, cursor, min(d, maxOutputWait))
+	}
+	return a.processOutput(p, cursor), nil
+}
+
+// writeProcessStdin sends input to a background process. A process that
+// stops reading would block the write forever once the pipe is full, so it
+// runs under the tool timeout (ToolingContext does not apply one to
+// mutating tools) and ends early when ctx is cancelled.
+// Flow: called by Tooling() for write_process_stdin.
+// Yields: a *pkg.ToolTimeoutError naming the bytes written when the
+// deadline passes first.
+func (a *Agent) writeProcessStdin(ctx context.Context, args map[string]any) (string, error) {
+	p, err := a.Procs.Get(argString(args, "id"))
+	if err != nil {
+		return "", err
+	}
+	input := argString(args, "input")
+	closeIn := argString(args, "close") == "true"
+	wctx := ctx
+	limit, rule := a.Policy.ToolTimeout("write_process_stdin")
+	if limit > 0 {
+		var cancel context.CancelFunc
+		wctx, cancel = context.WithTimeout(ctx, limit)
+		defer cancel()
+	}
+	if n, err := p.WriteInput(wctx, input, closeIn); err != nil {
+		switch {
+		case ctx.Err() != nil:
+			return "", fmt.Errorf("interrupted after writing %d of %d bytes to %s: %w", n, len(input), p.ID, ctx.Err())
+		case errors.Is(err, context.DeadlineExceeded):
+			terr := &pkg.ToolTimeoutError{Tool: "write_process_stdin", Limit: limit, Rule: rule}
+			a.Log.Warn(terr.Error())
+			return "", fmt.Errorf("%w; wrote %d of %d bytes, %s is not reading its input", terr, n, len(input), p.ID)
+		}
+		return "", err
+	}
+	msg := fmt.Sprintf("wrote %d bytes to %s", len(input), p.ID)
+	if closeIn {
+		msg += " and closed stdin"
+	}
+	return msg, nil
+}
+
+// stopProcess kills a background process and its children.
+// Flow: called by Tooling() for stop_process.
+func (a *Agent) stopProcess(args map[string]any) (string, error) {
+	id := argString(args, "id")
+	le := a.Log.Start("stop_process", id)
+	p, err := a.Procs.Stop(id)
+	if err != nil {
+		le.Error(err)
+		return "", err
+	}
+	le.Success(p.Status())
+	return fmt.Sprintf("stopped %s: %s", p.ID, p.Status()), nil
+}
+
+// exitOnSecondSignal lets a cancelled run wind down, but exits at once on
+// another SIGINT/SIGTERM: background processes are killed, temp files of
+// writes in flight removed and the audit log ended first.
+// Flow: installed by Run(); the returned func uninstalls it.
+func (a *Agent) exitOnSecondSignal(ctx context.Context) func() {
+	sig := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		a.Log.Warn("interrupted: finishing the current phase (Ctrl-C again to exit now)")
+		select {
+		case s := <-sig:
+			a.Procs.StopAll()
+			pkg.RemoveTempFiles()
+			_ = a.closeAudit(fmt.Errorf("interrupted (%s)", s))
+			code := 130
+			if s == syscall.SIGTERM {
+				code = 143
+			}
+			os.Exit(code)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(sig)
+		close(done)
+	}
+}
+
+// interrupted is the error a cancelled run ends with; it wraps the
+// context's cause (context.Canceled for Ctrl-C).
+func interrupted(ctx context.Context) error {
+	return fmt.Errorf("interrupted: %w", context.Cause(ctx))
+}
+
+// argInt reads an integer tool argument given as a JSON number or string.
+func argInt(args map[string]any, key string) int64 {
+	switch v := args[key].(type) {
+	case float64:
+		return int64(v)
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return 0
+}
+
+// processOutput renders a status header and the (redacted) output after cursor.
+func (a *Agent) processOutput(p *pkg.BackgroundProcess, cursor int64) string {
+	out, next, dropped := p.Output(cursor, a.Policy.OutputLimit())
+	head := fmt.Sprintf("id=%s status=%s next_cursor=%d", p.ID, p.Status(), next)
+	if dropped > 0 {
+		head += fmt.Sprintf(" (%d earlier bytes discarded)", dropped)
+	}
+	return head + "\n" + a.redactCommandSecrets(out)
+}
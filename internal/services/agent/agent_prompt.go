@@ -89,13 +89,71 @@ func (a *Agent) Prompt() {
 						"cmd":         map[string]any{"type": "string"},
 						"permissions": map[string]any{"type": "string"},
 						"timeout":     map[string]any{"type": "string"},
+						"reads":       map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "relative paths the command reads"},
+						"writes":      map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "relative paths the command may modify"},
 					},
 					"required": []string{"cmd"},
 				},
 			}),
+			openai.ChatCompletionFunctionTool(openai.FunctionDefinitionParam{
+				Name:        "start_process",
+				Description: openai.String(prompts.StartProcess),
+				Parameters: openai.FunctionParameters{
+					"type": "object",
+					"properties": map[string]any{
+						"cmd":         map[string]any{"type": "string"},
+						"permissions": map[string]any{"type": "string"},
+					},
+					"required": []string{"cmd"},
+				},
+			}),
+			openai.ChatCompletionFunctionTool(openai.FunctionDefinitionParam{
+				Name:        "read_process_output",
+				Description: openai.String(prompts.ReadProcessOutput),
+				Parameters: openai.FunctionParameters{
+					"type": "object",
+					"properties": map[string]any{
+						"id":     map[string]any{"type": "string"},
+						"cursor": map[string]any{"type": "integer"},
+						"wait":   map[string]any{"type": "string"},
+					},
+					"required": []string{"id"},
+				},
+			}),
+			openai.ChatCompletionFunctionTool(openai.FunctionDefinitionParam{
+				Name:        "write_process_stdin",
+				Description: openai.String(prompts.WriteProcessStdin),
+				Parameters: openai.FunctionParameters{
+					"type": "object",
+					"properties": map[string]any{
+						"id":    map[string]any{"type": "string"},
+						"input": map[string]any{"type": "string"},
+						"close": map[string]any{"type": "boolean"},
+					},
+					"required": []string{"id", "input"},
+				},
+			}),
+			openai.ChatCompletionFunctionTool(openai.FunctionDefinitionParam{
+				Name:        "stop_process",
+				Description: openai.String(prompts.StopProcess),
+				Parameters: openai.FunctionParameters{
+					"type": "object",
+					"properties": map[string]any{
+						"id": map[string]any{"type": "string"},
+					},
+					"required": []string{"id"},
+				},
+			}),
 		},
 	}
 
+	if a.Overlay != nil {
+		params.Messages = append(params.Messages, openai.UserMessage(
+			"Dry run: file writes and deletes are staged in memory and visible to later read_file/list_dir calls. "+
+				"run_command only sees the original files and is limited to read-only commands.",
+		))
+	}
+
 	modelLower := strings.ToLower(a.Model)
 	if strings.HasPrefix(modelLower, "gpt-5") || strings.HasPrefix(modelLower, "o") {
 		params.ReasoningEffort = shared.ReasoningEffortHigh
@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"cds.agents.app/pkg"
+)
+
+// agentState are the files that steer later runs: rewriting approvals.json
+// would approve any call, rewriting policy.yaml would lift the policy.
+var agentState = []string{pkg.PolicyFile, pkg.ApprovalsFile}
+
+// protectAgentState adds the policy and approvals files to this run's
+// paths.protect, whatever the policy file says; the sandbox then mounts
+// them read-only.
+// Flow: called by NewAgent() once the policy is set.
+func (a *Agent) protectAgentState() {
+	a.protect(agentState...)
+}
+
+// protect adds globs to this run's paths.protect unless already covered.
+func (a *Agent) protect(globs ...string) {
+	// a copy, so a policy shared with other agents is left untouched
+	p := *pkg.DefaultPolicy()
+	if a.Policy != nil {
+		p = *a.Policy
+	}
+	p.Paths.Protect = slices.Clone(p.Paths.Protect)
+	for _, g := range globs {
+		if p.CheckProtected(g) == nil {
+			p.Paths.Protect = append(p.Paths.Protect, g)
+		}
+	}
+	a.Policy = &p
+}
+
+// agentStateMissing reports whether a state file does not exist yet, so
+// the sandbox has no file to mount read-only in its place.
+func agentStateMissing(src string) bool {
+	for _, f := range agentState {
+		if _, err := os.Lstat(filepath.Join(src, filepath.FromSlash(f))); err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// checkProtectedTree refuses deleting a directory that holds protected paths.
+// Flow: called by Tooling() for delete_path after the path resolves.
+// Yields: a *pkg.PolicyError naming the first protected entry found.
+func (a *Agent) checkProtectedTree(root, abs string) error {
+	found := a.protectedUnder(root, abs)
+	if len(found) == 0 {
+		return nil
+	}
+	rel, inner := relSlash(root, abs), relSlash(root, found[0])
+	return &pkg.PolicyError{Rule: "paths.protect", Reason: fmt.Sprintf("%s contains protected path %s and cannot be deleted", rel, inner)}
+}
+
+// protectedUnder lists existing paths under abs that match paths.protect;
+// a matching directory is listed once, without its contents.
+func (a *Agent) protectedUnder(root, abs string) []string {
+	return a.matchingUnder(root, abs, a.Policy.CheckProtected)
+}
+
+// deniedUnder lists existing paths under abs that match paths.deny, which
+// the sandbox hides from commands.
+func (a *Agent) deniedUnder(root, abs string) []string {
+	if len(a.Policy.DeniedGlobs()) == 0 {
+		return nil
+	}
+	return a.matchingUnder(root, abs, a.Policy.CheckDenied)
+}
+
+// matchingUnder lists existing paths under abs that check refuses.
+func (a *Agent) matchingUnder(root, abs string, check func(rel string) error) []string {
+	var out []string
+	_ = pkg.WalkDir(a.Ws, abs, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d == nil {
+			return nil
+		}
+		if check(relSlash(root, p)) != nil {
+			out = append(out, p)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	return out
+}
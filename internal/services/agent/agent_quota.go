@@ -0,0 +1,35 @@
+package agent
+
+import (
+	"errors"
+	"io/fs"
+
+	"cds.agents.app/pkg"
+)
+
+// withQuota appends the budget a call draws on to its result, so the model
+// can plan within what is left of the run's quotas.
+// Flow: called by RunPhases() for every executed call.
+func (a *Agent) withQuota(name, out string, err error) string {
+	var qerr *pkg.QuotaError
+	if errors.As(err, &qerr) {
+		return out
+	}
+	if left := a.Quotas.Remaining(name); left != "" {
+		return out + "\n(quota left this run: " + left + ")"
+	}
+	return out
+}
+
+// countFiles is how many deletions removing abs costs: its files, or one
+// for a lone file, link or empty directory.
+func (a *Agent) countFiles(abs string) int {
+	n := 0
+	_ = pkg.WalkDir(a.Ws, abs, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d != nil && !d.IsDir() {
+			n++
+		}
+		return nil
+	})
+	return max(n, 1)
+}
@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// finish prints the change report, completes a dry run and makes the final commit.
+// Flow: deferred by Run(); runs however the run ends (runErr is the loop result).
+// Yields: none; returns the first reporting error.
+func (a *Agent) finish(ctx context.Context, runErr error) error {
+	err := a.printChangeReport(errors.Is(runErr, context.Canceled))
+	if a.GitCommit {
+		status := "completed"
+		if runErr != nil {
+			status = runErr.Error()
+		}
+		if gerr := a.gitCommit(ctx, a.stepsUsed, status); gerr != nil && err == nil {
+			err = gerr
+		}
+	}
+	if a.Overlay != nil {
+		if derr := a.finishDryRun(); derr != nil && err == nil {
+			err = derr
+		}
+	}
+	return err
+}
+
+// printChangeReport renders created/modified/deleted files with diffs;
+// partial marks a run cut short by Ctrl-C.
+// Flow: called by finish() at the end of Run().
+// Yields: none; writes Markdown to ReportMD when set.
+func (a *Agent) printChangeReport(partial bool) error {
+	r := a.Changes.Report(a.Ws)
+	body := r.Terminal()
+	if n := a.cmdWrites.Load(); n > 0 {
+		body += fmt.Sprintf("\n(%d writable run_command call(s); their file changes are not listed)", n)
+	}
+	title := "CHANGES"
+	if a.Overlay != nil {
+		title = "CHANGES (dry run, not applied)"
+	}
+	md := r.Markdown()
+	if partial {
+		title += " (partial: run interrupted)"
+		body += fmt.Sprintf("\n(interrupted during turn %d; calls that had not started were skipped)", a.stepsUsed)
+		md = strings.Replace(md, "\n\n", "\n\n_Partial: the run was interrupted during turn "+fmt.Sprint(a.stepsUsed)+"._\n\n", 1)
+	}
+	a.Log.PrintReport(title, body)
+
+	if a.ReportMD == "" {
+		return nil
+	}
+	// append so the file can be a CI job summary shared with other steps
+	f, err := os.OpenFile(a.ReportMD, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(a.Redactor.Redact(md)); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"cds.agents.app/pkg"
+)
+
+// checkWriteSecrets scans write_file content for credentials.
+// Flow: called by Tooling() before the workspace is mutated.
+// Yields: an error explaining the block when secrets.writes is "block".
+func (a *Agent) checkWriteSecrets(root, abs, content string) error {
+	rules := a.Policy.SecretSettings()
+	rel := relSlash(root, abs)
+	if rules.Writes == "off" || matchAny(rules.Ignore, rel) {
+		return nil
+	}
+	findings := pkg.ScanSecrets(content)
+	if len(findings) == 0 {
+		return nil
+	}
+	list := joinFindings(findings)
+	if rules.Writes == "warn" {
+		a.Log.Warn(fmt.Sprintf("secrets: write_file %s contains %s", rel, list))
+		return nil
+	}
+	a.Log.Warn(fmt.Sprintf("secrets: blocked write_file %s: %s", rel, list))
+	return fmt.Errorf("write to %s blocked: content looks like it contains credentials (%s). Read secrets from environment variables or a secret manager instead of committing them; placeholders such as \"changeme\" or ${VAR} are fine (policy secrets.writes)", rel, list)
+}
+
+// filterReadSecrets redacts or refuses credentials in read_file content.
+// Flow: called by Tooling() before a read_file result is returned.
+// Yields: the content to hand to the model, or an error under secrets.reads "deny".
+func (a *Agent) filterReadSecrets(root, abs, content string) (string, error) {
+	rules := a.Policy.SecretSettings()
+	rel := relSlash(root, abs)
+	if rules.Reads == "allow" || matchAny(rules.Ignore, rel) {
+		return content, nil
+	}
+	sensitive := matchAny(rules.Sensitive, rel)
+	findings := pkg.ScanSecrets(content)
+	if !sensitive && len(findings) == 0 {
+		return content, nil
+	}
+	what := joinFindings(findings)
+	if sensitive {
+		what = "credentials file"
+	}
+	if rules.Reads == "deny" {
+		a.Log.Warn(fmt.Sprintf("secrets: denied read_file %s: %s", rel, what))
+		return "", fmt.Errorf("reading %s is denied: %s (policy secrets.reads)", rel, what)
+	}
+	a.Log.Warn(fmt.Sprintf("secrets: redacted read_file %s: %s", rel, what))
+	content = pkg.RedactSecrets(content, findings)
+	if sensitive {
+		content = pkg.RedactAssignments(content)
+	}
+	return content, nil
+}
+
+// redactCommandSecrets masks credentials in run_command output.
+// Flow: called by runCommand before output is returned.
+func (a *Agent) redactCommandSecrets(out string) string {
+	if a.Policy.SecretSettings().Reads == "allow" {
+		return out
+	}
+	return pkg.RedactSecrets(out, pkg.ScanSecrets(out))
+}
+
+func relSlash(root, abs string) string {
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return filepath.ToSlash(abs)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func matchAny(globs []string, rel string) bool {
+	return slices.ContainsFunc(globs, func(g string) bool { return pkg.MatchGlob(g, rel) })
+}
+
+func joinFindings(fs []pkg.SecretFinding) string {
+	parts := make([]string, len(fs))
+	for i, f := range fs {
+		parts[i] = f.String()
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,31 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"cds.agents.app/pkg"
+)
+
+// slowCall reports whether a call of tool that took elapsed is over the
+// policy's slow threshold. Commands and process-output waits are slow by
+// design and never count.
+func (a *Agent) slowCall(tool string, elapsed time.Duration) bool {
+	switch tool {
+	case "run_command", "read_process_output":
+		return false
+	}
+	limit := a.Policy.SlowCall()
+	return limit > 0 && elapsed >= limit
+}
+
+// reportSlow logs a call over the slow threshold so pathological
+// operations (huge trees, hung mounts) stand out.
+// Flow: deferred by ToolingContext() for every call.
+func (a *Agent) reportSlow(tool, rawArgs string, elapsed time.Duration) {
+	if !a.slowCall(tool, elapsed) {
+		return
+	}
+	call := pkg.CallSummary(pkg.ToolCallLite{FuncName: tool, FuncArgs: rawArgs})
+	a.Log.Warn(fmt.Sprintf("slow: %s took %s (limits.slow_call %s)", call, elapsed.Round(time.Millisecond), a.Policy.SlowCall()))
+}
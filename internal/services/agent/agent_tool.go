@@ -3,36 +3,113 @@ package agent
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"time"
+
+	"cds.agents.app/pkg"
 )
 
 
 // Tooling runs a single tool call and returns its textual result.
-// Flow: called within RunPhases() concurrently per phase item.
+// Flow: wrapper for callers without a model call id (tests, tools).
 // Yields: returns tool output to be appended as ToolMessage.
 func (a *Agent) Tooling(root string, name string, rawArgs string) (string, error) {
+	return a.ToolingCall(root, "", name, rawArgs)
+}
+
+// ToolingCall runs a single tool call identified by the model's call id,
+// which names artifacts such as spilled command output.
+// Flow: wrapper for callers without a run context (tests, tools).
+// Yields: returns tool output to be appended as ToolMessage.
+func (a *Agent) ToolingCall(root, callID, name, rawArgs string) (string, error) {
+	return a.ToolingContext(context.Background(), root, callID, name, rawArgs)
+}
+
+// ToolingContext runs a single tool call; cancelling ctx refuses a call
+// that has not started, kills a running command's process group and ends
+// waits. File operations in progress finish, so no partial write is left.
+// Tools that change nothing (listings, reads, output waits) run under the
+// policy's tool timeout and are abandoned when it passes; writes, deletes
+// and process control always run to completion so their outcome is known
+// (write_process_stdin applies the timeout itself, see writeProcessStdin).
+// Calls over the slow threshold are logged.
+// Flow: called within RunPhases() concurrently per phase item.
+// Yields: returns tool output to be appended as ToolMessage; a
+// *pkg.ToolTimeoutError when the deadline passes first.
+func (a *Agent) ToolingContext(ctx context.Context, root, callID, name, rawArgs string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("interrupted: %w", err)
+	}
+	start := time.Now()
+	defer func() { a.reportSlow(name, rawArgs, time.Since(start)) }()
+
+	limit, rule := a.Policy.ToolTimeout(name)
+	// run_command has its own timeout; abandoning a mutating call would
+	// leave it holding its path lock and finishing behind the model's back
+	if name == "run_command" || mutates(pkg.ToolCallLite{FuncName: name}) || limit <= 0 {
+		return a.tooling(ctx, root, callID, name, rawArgs)
+	}
+	ctx, cancel := context.WithTimeout(ctx, limit)
+	defer cancel()
+	type result struct {
+		out string
+		err error
+	}
+	// a read stuck in the kernel (a hung network mount) cannot be
+	// interrupted; it is abandoned and finishes, or not, on its own
+	done := make(chan result, 1)
+	go func() {
+		out, err := a.tooling(ctx, root, callID, name, rawArgs)
+		done <- result{out, err}
+	}()
+	select {
+	case r := <-done:
+		// a walk that stopped at the deadline reports it as a timeout too
+		if r.err == nil || ctx.Err() != context.DeadlineExceeded {
+			return r.out, r.err
+		}
+	case <-ctx.Done():
+		if ctx.Err() != context.DeadlineExceeded {
+			return "", fmt.Errorf("interrupted: %w", ctx.Err())
+		}
+	}
+	err := &pkg.ToolTimeoutError{Tool: name, Limit: limit, Rule: rule}
+	a.Log.Warn(err.Error())
+	return "", err
+}
+
+// tooling dispatches one call to its tool after the policy, quota and path
+// checks; tools that walk trees stop early when ctx is done.
+func (a *Agent) tooling(ctx context.Context, root, callID, name, rawArgs string) (string, error) {
+
 	// Parse JSON args
 	var args map[string]any
 	_ = json.Unmarshal([]byte(rawArgs), &args)
 
-	// Path guard: stay inside src directory
+	// Policy: tools, paths and commands allowed in this repo
+	if err := a.Policy.Check(root, name, args); err != nil {
+		return "", err
+	}
+	// Quotas: run-wide budget per tool (writes, deletions, commands below)
+	if err := a.Quotas.Call(name); err != nil {
+		return "", err
+	}
+
+	// Path guard: stay inside src directory, following symlinks per policy
+	// (delete_path removes a link itself), then re-check the real target.
 	resolve := func(rel string) (string, error) {
-		if rel == "" {
-			return "", errors.New("path required")
+		abs, err := pkg.ResolveInRoot(root, rel, a.Policy.SymlinkMode(), name != "delete_path")
+		if err != nil {
+			return "", err
 		}
-		abs := filepath.Join(root, filepath.FromSlash(rel))
-		relBack, err := filepath.Rel(root, abs)
-		if err != nil || strings.HasPrefix(relBack, "..") {
-			return "", errors.New("refusing to access outside source directory")
+		real, _ := filepath.Rel(root, abs)
+		if err := a.Policy.CheckPath(real, name == "write_file" || name == "delete_path"); err != nil {
+			return "", err
 		}
-		return filepath.Clean(abs), nil
+		return abs, nil
 	}
 
 	switch name {
@@ -50,7 +127,7 @@ func (a *Agent) Tooling(root string, name string, rawArgs string) (string, error
 		mu.RLock()
 		defer mu.RUnlock()
 
-		ents, err := os.ReadDir(abs)
+		ents, err := a.Ws.ReadDir(abs)
 		if err != nil {
 			le.Error(err)
 			return "", err
@@ -81,10 +158,13 @@ func (a *Agent) Tooling(root string, name string, rawArgs string) (string, error
 		defer mu.RUnlock()
 
 		var out []string
-		err = filepath.WalkDir(abs, func(p string, d os.DirEntry, err error) error {
+		err = pkg.WalkDir(a.Ws, abs, func(p string, d os.DirEntry, err error) error {
 			if err != nil {
 				return err
 			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			rel, _ := filepath.Rel(abs, p)
 			if rel == "." {
 				return nil
@@ -114,14 +194,19 @@ func (a *Agent) Tooling(root string, name string, rawArgs string) (string, error
 		mu.RLock()
 		defer mu.RUnlock()
 
-		b, err := os.ReadFile(abs)
+		b, err := a.Ws.ReadFile(abs)
+		if err != nil {
+			le.Error(err)
+			return "", err
+		}
+		text, err := a.filterReadSecrets(root, abs, string(b))
 		if err != nil {
 			le.Error(err)
 			return "", err
 		}
 		le.Success(fmt.Sprintf("%d bytes", len(b)))
 
-		return string(b), nil
+		return text, nil
 
 	case "write_file":
 		p := fmt.Sprint(args["path"])
@@ -131,11 +216,24 @@ func (a *Agent) Tooling(root string, name string, rawArgs string) (string, error
 		if err != nil {
 			return "", err
 		}
+		if err := a.checkWriteSecrets(root, abs, content); err != nil {
+			le.Error(err)
+			return "", err
+		}
 		mu := a.Lm.Get(abs)
 		mu.Lock()
 		defer mu.Unlock()
 
-		if err := a.Lm.WriteAtomic(abs, []byte(content)); err != nil {
+		// reserved under the path's lock, so a refund cannot undo a
+		// concurrent write of the same file
+		refund, err := a.Quotas.Write(abs, int64(len(content)))
+		if err != nil {
+			le.Error(err)
+			return "", err
+		}
+		a.Changes.Snapshot(a.Ws, abs)
+		if err := a.Ws.WriteFile(abs, []byte(content)); err != nil {
+			refund()
 			le.Error(err)
 			return "", err
 		}
@@ -149,11 +247,20 @@ func (a *Agent) Tooling(root string, name string, rawArgs string) (string, error
 		if err != nil {
 			return "", err
 		}
+		if err := a.checkProtectedTree(root, abs); err != nil {
+			le.Error(err)
+			return "", err
+		}
+		if err := a.Quotas.Delete(a.countFiles(abs)); err != nil {
+			le.Error(err)
+			return "", err
+		}
 		mu := a.Lm.Get(abs)
 		mu.Lock()
 		defer mu.Unlock()
 
-		if err := os.RemoveAll(abs); err != nil {
+		a.Changes.SnapshotTree(a.Ws, abs)
+		if err := a.Ws.RemoveAll(abs); err != nil {
 			le.Error(err)
 			return "", err
 		}
@@ -161,84 +268,19 @@ func (a *Agent) Tooling(root string, name string, rawArgs string) (string, error
 		return "deleted " + p, nil
 
 	case "run_command":
-		cmdline := fmt.Sprint(args["cmd"])
-		perms := fmt.Sprint(args["permissions"])
-		to := fmt.Sprint(args["timeout"]) // e.g., "60s"
-		if cmdline == "" {
-			return "", errors.New("cmd required")
-		}
-		le := a.Log.Start("run_command", cmdline)
-		// permissions parsing
-		_ = strings.Contains(perms, "r") // r currently does not gate execution; kept for future read-only policies
-		allowW := strings.Contains(perms, "w")
-		allowX := strings.Contains(perms, "x")
-
-		// basic denylist regardless of perms
-		deny := []string{"sudo", "mount", "umount", "iptables", "ifconfig", "ssh", "scp", "curl", "wget", "nc", "rm -rf /"}
-		for _, d := range deny {
-			if strings.Contains(cmdline, d) {
-				return "", fmt.Errorf("command contains disallowed token: %s", d)
-			}
-		}
+		return a.runCommand(ctx, args, a.callName(callID))
 
-		// classify mutation attempts
-		mutating := false
-		writeTokens := []string{"rm ", "mv ", "cp ", "chmod ", "chown ", "git commit", "git add", "git reset", "git revert", "go mod tidy", "sed -i", "tee ", ">", ">>"}
-		for _, t := range writeTokens {
-			if strings.Contains(cmdline, t) {
-				mutating = true
-				break
-			}
-		}
-		if mutating && !allowW {
-			return "", errors.New("write permissions required (use permissions contains 'w')")
-		}
+	case "start_process":
+		return a.startProcess(args)
 
-		// disallow executing arbitrary binaries without x
-		execBinary := false
-		reWord := regexp.MustCompile(`^\s*([a-zA-Z0-9_./-]+)`) // first token
-		m := reWord.FindStringSubmatch(cmdline)
-		if len(m) > 1 {
-			bin := m[1]
-			if strings.Contains(bin, "/") {
-				execBinary = true
-			}
-		}
-		if execBinary && !allowX {
-			return "", errors.New("execute permissions required (include 'x') for running binaries by path")
-		}
+	case "read_process_output":
+		return a.readProcessOutput(ctx, args)
 
-		// prepare context with timeout
-		dur := 60 * time.Second
-		if to != "" {
-			if parsed, err := time.ParseDuration(to); err == nil && parsed > 0 && parsed <= 5*time.Minute {
-				dur = parsed
-			}
-		}
-		ctx, cancel := context.WithTimeout(context.Background(), dur)
-		defer cancel()
+	case "write_process_stdin":
+		return a.writeProcessStdin(ctx, args)
 
-		// execute via shell
-		c := exec.CommandContext(ctx, "bash", "-lc", cmdline)
-		c.Dir = a.Src
-		// inherit limited env, redact secrets from logs; env remains same
-		c.Env = os.Environ()
-		out, err := c.CombinedOutput()
-		text := string(out)
-		if len(text) > 4000 {
-			text = text[:4000] + "\n...[truncated]"
-		}
-		if ctx.Err() == context.DeadlineExceeded {
-			le.Error(errors.New("timeout"))
-			return text + "\n(timeout)", errors.New("command timed out")
-		}
-		if err != nil {
-			le.Error(err)
-			// return both output and error for visibility
-			return text, err
-		}
-		le.Success("ok")
-		return text, nil
+	case "stop_process":
+		return a.stopProcess(args)
 
 	default:
 		return "", fmt.Errorf("unknown tool: %s", name)
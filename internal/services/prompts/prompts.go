@@ -35,3 +35,19 @@ var DeletePath string
 // RunCommand describes the run_command tool.
 //go:embed run_command.md
 var RunCommand string
+
+// StartProcess describes the start_process tool.
+//go:embed start_process.md
+var StartProcess string
+
+// ReadProcessOutput describes the read_process_output tool.
+//go:embed read_process_output.md
+var ReadProcessOutput string
+
+// WriteProcessStdin describes the write_process_stdin tool.
+//go:embed write_process_stdin.md
+var WriteProcessStdin string
+
+// StopProcess describes the stop_process tool.
+//go:embed stop_process.md
+var StopProcess string
@@ -0,0 +1,175 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditEnd is the type of the record that closes a complete audit log; a log
+// without it was truncated (or its run was killed).
+const AuditEnd = "run_end"
+
+// auditGenesis is the prev hash of the first record.
+var auditGenesis = strings.Repeat("0", 64)
+
+// AuditRecord is one line of an audit log. Hash covers every other field and
+// Prev links it to the record before it, so editing, reordering or dropping
+// lines breaks the chain.
+type AuditRecord struct {
+	Seq  int64           `json:"seq"`
+	Time string          `json:"time"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+	Prev string          `json:"prev"`
+	Hash string          `json:"hash"`
+}
+
+// AuditLog appends hash-chained records to a JSONL file. A nil *AuditLog
+// discards everything, so callers need no checks when auditing is off.
+// Flow: created by NewAgent; fed by Run(), RunPhases() and finish().
+type AuditLog struct {
+	Path string
+
+	mu   sync.Mutex
+	f    *os.File
+	seq  int64
+	prev string
+	err  error // first write error; later records are dropped
+}
+
+// CreateAuditLog creates a new audit log at path; an existing file is never
+// reused, so a log always holds exactly one run.
+func CreateAuditLog(path string) (*AuditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{Path: path, f: f, prev: auditGenesis}, nil
+}
+
+// Append writes one record of the given type with data marshaled as JSON.
+func (l *AuditLog) Append(typ string, data any) error {
+	if l == nil {
+		return nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+	r := AuditRecord{Seq: l.seq, Time: time.Now().UTC().Format(time.RFC3339Nano), Type: typ, Data: raw, Prev: l.prev}
+	r.Hash = auditHash(r)
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		l.err = fmt.Errorf("audit log %s: %w", l.Path, err)
+		return l.err
+	}
+	l.seq++
+	l.prev = r.Hash
+	return nil
+}
+
+// Close appends the end record and syncs the file.
+func (l *AuditLog) Close(data any) error {
+	if l == nil {
+		return nil
+	}
+	err := l.Append(AuditEnd, data)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if serr := l.f.Sync(); serr != nil && err == nil {
+		err = serr
+	}
+	if cerr := l.f.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// auditHash is the SHA-256 over the record's fields (Hash excluded).
+func auditHash(r AuditRecord) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n%s\n%s\n%s\n", r.Seq, r.Time, r.Type, r.Prev)
+	h.Write(r.Data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// AuditSummary describes a verified audit log.
+type AuditSummary struct {
+	Records int
+	First   string // time of the first record
+	Last    string // time of the last record
+	Head    string // hash of the last record
+}
+
+// VerifyAudit checks the hash chain of an audit log read from r.
+// Flow: used by `agent audit verify`.
+// Yields: a summary, or an error naming the first line that was altered,
+// inserted, reordered or removed, or that the log was truncated.
+func VerifyAudit(r io.Reader) (AuditSummary, error) {
+	var s AuditSummary
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), 256<<20)
+	prev, typ := auditGenesis, ""
+	for line := 1; sc.Scan(); line++ {
+		var rec AuditRecord
+		dec := json.NewDecoder(bytes.NewReader(sc.Bytes()))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&rec); err != nil {
+			return s, fmt.Errorf("line %d: not an audit record: %w", line, err)
+		}
+		switch {
+		case typ == AuditEnd:
+			return s, fmt.Errorf("line %d: record after %s", line, AuditEnd)
+		case rec.Seq != int64(line-1):
+			return s, fmt.Errorf("line %d: sequence %d, want %d (records removed or reordered)", line, rec.Seq, line-1)
+		case rec.Prev != prev:
+			return s, fmt.Errorf("line %d: chain broken: prev %.12s does not match the hash of line %d", line, rec.Prev, line-1)
+		case auditHash(rec) != rec.Hash:
+			return s, fmt.Errorf("line %d: hash mismatch (record modified)", line)
+		}
+		if s.Records == 0 {
+			s.First = rec.Time
+		}
+		s.Records++
+		s.Last, s.Head = rec.Time, rec.Hash
+		prev, typ = rec.Hash, rec.Type
+	}
+	if err := sc.Err(); err != nil {
+		return s, err
+	}
+	if s.Records == 0 {
+		return s, errors.New("empty audit log")
+	}
+	if typ != AuditEnd {
+		return s, fmt.Errorf("truncated: last record (line %d) is %q, not %s", s.Records, typ, AuditEnd)
+	}
+	return s, nil
+}
+
+// SHA256Hex hashes s for audit records that reference content by digest.
+func SHA256Hex(s []byte) string {
+	sum := sha256.Sum256(s)
+	return hex.EncodeToString(sum[:])
+}
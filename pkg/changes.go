@@ -0,0 +1,212 @@
+package pkg
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ChangeTracker snapshots files before their first mutation in a run.
+// Flow: created by NewAgent; fed by write_file/delete_path in Tooling().
+type ChangeTracker struct {
+	root   string
+	mu     sync.Mutex
+	before map[string]*[]byte // abs path -> original content (nil = did not exist)
+}
+
+// NewChangeTracker constructs an empty tracker for paths under root.
+func NewChangeTracker(root string) *ChangeTracker {
+	return &ChangeTracker{root: filepath.Clean(root), before: map[string]*[]byte{}}
+}
+
+// Snapshot records the original content of name if not already recorded.
+// Flow: called by write_file before the workspace is mutated.
+func (t *ChangeTracker) Snapshot(ws Workspace, name string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.snapshotLocked(ws, name)
+}
+
+// SnapshotTree records every file below name (and name itself).
+// Flow: called by delete_path before the workspace is mutated.
+func (t *ChangeTracker) SnapshotTree(ws Workspace, name string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_ = WalkDir(ws, name, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			t.snapshotLocked(ws, p)
+		}
+		return nil
+	})
+}
+
+func (t *ChangeTracker) snapshotLocked(ws Workspace, name string) {
+	if _, ok := t.before[name]; ok {
+		return
+	}
+	if b, err := ws.ReadFile(name); err == nil {
+		t.before[name] = &b
+		return
+	}
+	t.before[name] = nil
+}
+
+// FileChange is one entry in a ChangeReport.
+type FileChange struct {
+	Path    string // slash-separated, relative to the source root
+	Status  string // created | modified | deleted
+	Added   int
+	Removed int
+	Diff    string
+}
+
+// ChangeReport summarizes all files touched during a run.
+type ChangeReport struct {
+	Files []FileChange
+}
+
+// Report compares snapshots with the current workspace state.
+// Flow: called once when Run() finishes.
+func (t *ChangeTracker) Report(ws Workspace) ChangeReport {
+	var r ChangeReport
+	if t == nil {
+		return r
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for abs, orig := range t.before {
+		rel, err := filepath.Rel(t.root, abs)
+		if err != nil {
+			rel = abs
+		}
+		rel = filepath.ToSlash(rel)
+		after, rerr := ws.ReadFile(abs)
+		fc := FileChange{Path: rel}
+		var before []byte
+		from, to := "a/"+rel, "b/"+rel
+		switch {
+		case orig == nil && rerr != nil:
+			continue // created and deleted again
+		case orig == nil:
+			fc.Status, from = "created", "/dev/null"
+		case rerr != nil:
+			fc.Status, to, before, after = "deleted", "/dev/null", *orig, nil
+		case string(*orig) == string(after):
+			continue
+		default:
+			fc.Status, before = "modified", *orig
+		}
+		fc.Added, fc.Removed = DiffStat(before, after)
+		fc.Diff = UnifiedDiff(from, to, before, after, 3)
+		r.Files = append(r.Files, fc)
+	}
+	sort.Slice(r.Files, func(i, j int) bool { return r.Files[i].Path < r.Files[j].Path })
+	return r
+}
+
+// Counts returns the number of created, modified and deleted files.
+func (r ChangeReport) Counts() (created, modified, deleted int) {
+	for _, f := range r.Files {
+		switch f.Status {
+		case "created":
+			created++
+		case "modified":
+			modified++
+		case "deleted":
+			deleted++
+		}
+	}
+	return
+}
+
+// Summary is a one-line description of the report.
+func (r ChangeReport) Summary() string {
+	c, m, d := r.Counts()
+	return fmt.Sprintf("%d file(s) changed: %d created, %d modified, %d deleted", len(r.Files), c, m, d)
+}
+
+// Terminal renders the report with lipgloss styling.
+// Flow: printed to stderr by the agent at the end of Run().
+func (r ChangeReport) Terminal() string {
+	if len(r.Files) == 0 {
+		return lipgloss.NewStyle().Faint(true).Render("no file changes")
+	}
+	status := map[string]lipgloss.Style{
+		"created":  lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("82")),
+		"modified": lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("214")),
+		"deleted":  lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("196")),
+	}
+	add := lipgloss.NewStyle().Foreground(lipgloss.Color("82"))
+	del := lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+
+	var sb strings.Builder
+	sb.WriteString(lipgloss.NewStyle().Bold(true).Render(r.Summary()) + "\n")
+	for _, f := range r.Files {
+		sb.WriteString(fmt.Sprintf("  %s %s %s %s\n",
+			status[f.Status].Width(9).Render(f.Status), f.Path,
+			add.Render(fmt.Sprintf("+%d", f.Added)), del.Render(fmt.Sprintf("-%d", f.Removed))))
+	}
+	for _, f := range r.Files {
+		sb.WriteString("\n" + ColorDiff(f.Diff))
+	}
+	return sb.String()
+}
+
+// Markdown renders the report for CI job summaries.
+// Flow: written to --report-md (e.g. $GITHUB_STEP_SUMMARY).
+func (r ChangeReport) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString("## Agent change report\n\n")
+	if len(r.Files) == 0 {
+		sb.WriteString("No file changes.\n")
+		return sb.String()
+	}
+	sb.WriteString(r.Summary() + "\n\n")
+	sb.WriteString("| Status | File | + | - |\n|---|---|---:|---:|\n")
+	for _, f := range r.Files {
+		sb.WriteString(fmt.Sprintf("| %s | `%s` | %d | %d |\n", f.Status, f.Path, f.Added, f.Removed))
+	}
+	for _, f := range r.Files {
+		sb.WriteString(fmt.Sprintf("\n<details><summary><code>%s</code> (%s)</summary>\n\n```diff\n%s```\n\n</details>\n", f.Path, f.Status, f.Diff))
+	}
+	return sb.String()
+}
+
+// ColorDiff styles unified diff lines for the terminal.
+// Flow: used by change reports and approval previews.
+func ColorDiff(diff string) string {
+	add := lipgloss.NewStyle().Foreground(lipgloss.Color("82"))
+	del := lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+	hunk := lipgloss.NewStyle().Foreground(lipgloss.Color("81"))
+	head := lipgloss.NewStyle().Bold(true)
+	var sb strings.Builder
+	for _, l := range strings.SplitAfter(diff, "\n") {
+		line := strings.TrimSuffix(l, "\n")
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			line = head.Render(line)
+		case strings.HasPrefix(line, "+"):
+			line = add.Render(line)
+		case strings.HasPrefix(line, "-"):
+			line = del.Render(line)
+		case strings.HasPrefix(line, "@@"):
+			line = hunk.Render(line)
+		}
+		sb.WriteString(line)
+		if strings.HasSuffix(l, "\n") {
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
@@ -13,4 +13,23 @@ type Config struct {
 	Log          bool
 	ToolChoice   string
 	RequireTools []string
+	DryRun       bool
+	OutputPatch  string
+	Approve      bool
+	ReportMD     string
+
+	GitCommit      bool
+	CommitEachTurn bool
+	AllowDirty     bool
+
+	AuditLog    string
+	PlanGraph   string
+	StopOnError bool
+
+	Policy     *Policy
+	PolicyPath string
+
+	// Scheduler, when set, is shared with other agents instead of a
+	// per-run pool of Concurrency slots.
+	Scheduler *Scheduler
 }
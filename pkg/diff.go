@@ -0,0 +1,208 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxDiffCells bounds the LCS table used for the changed region of a diff.
+// Larger regions are rendered as a full replacement instead.
+const maxDiffCells = 4_000_000
+
+type diffOp struct {
+	kind byte // ' ', '-', '+'
+	text string
+}
+
+// UnifiedDiff renders a unified diff between two file versions.
+// Flow: used by dry-run and change reports to show file edits.
+// Yields: empty string when both versions are identical.
+func UnifiedDiff(fromName, toName string, from, to []byte, context int) string {
+	if string(from) == string(to) {
+		return ""
+	}
+	a, b := splitLines(string(from)), splitLines(string(to))
+	ops := diffLines(a, b)
+
+	var sb strings.Builder
+	sb.WriteString("--- " + fromName + "\n")
+	sb.WriteString("+++ " + toName + "\n")
+
+	// Walk the edit script and emit hunks with surrounding context lines.
+	i := 0
+	for i < len(ops) {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			// stop when the run of unchanged lines is too long to bridge two changes
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				end += min(context, run-end)
+				break
+			}
+			end = run
+		}
+		writeHunk(&sb, ops, start, end)
+		i = end
+	}
+	return sb.String()
+}
+
+// writeHunk emits a single @@ hunk covering ops[start:end].
+func writeHunk(sb *strings.Builder, ops []diffOp, start, end int) {
+	oldLine, newLine := 1, 1
+	for _, op := range ops[:start] {
+		if op.kind != '+' {
+			oldLine++
+		}
+		if op.kind != '-' {
+			newLine++
+		}
+	}
+	oldCount, newCount := 0, 0
+	for _, op := range ops[start:end] {
+		if op.kind != '+' {
+			oldCount++
+		}
+		if op.kind != '-' {
+			newCount++
+		}
+	}
+	if oldCount == 0 {
+		oldLine--
+	}
+	if newCount == 0 {
+		newLine--
+	}
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n", hunkRange(oldLine, oldCount), hunkRange(newLine, newCount))
+	for _, op := range ops[start:end] {
+		sb.WriteByte(op.kind)
+		sb.WriteString(strings.TrimSuffix(op.text, "\n"))
+		sb.WriteByte('\n')
+		if !strings.HasSuffix(op.text, "\n") {
+			sb.WriteString("\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(line, count int) string {
+	if count == 1 {
+		return fmt.Sprint(line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+// splitLines splits text into lines, keeping the trailing newline on each.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes a line edit script: common prefix/suffix are trimmed and
+// the remaining region is diffed with an LCS table when small enough.
+func diffLines(a, b []string) []diffOp {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	var ops []diffOp
+	for _, l := range a[:pre] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	ops = append(ops, diffMiddle(a[pre:len(a)-suf], b[pre:len(b)-suf])...)
+	for _, l := range a[len(a)-suf:] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	return ops
+}
+
+func diffMiddle(a, b []string) []diffOp {
+	var ops []diffOp
+	if len(a)*len(b) > maxDiffCells {
+		for _, l := range a {
+			ops = append(ops, diffOp{'-', l})
+		}
+		for _, l := range b {
+			ops = append(ops, diffOp{'+', l})
+		}
+		return ops
+	}
+	// lcs[i][j] = length of LCS of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// DiffStat counts added and removed lines between two file versions.
+// Flow: used by change reports for per-file line counts.
+func DiffStat(from, to []byte) (added, removed int) {
+	if string(from) == string(to) {
+		return 0, 0
+	}
+	for _, op := range diffLines(splitLines(string(from)), splitLines(string(to))) {
+		switch op.kind {
+		case '+':
+			added++
+		case '-':
+			removed++
+		}
+	}
+	return added, removed
+}
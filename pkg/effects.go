@@ -0,0 +1,179 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// CommandEffects are the paths a run_command call reads and writes,
+// slash-separated and relative to --src ("." is the whole tree).
+// Flow: computed by PlanPhases() to order commands against file tools.
+type CommandEffects struct {
+	Reads    []string
+	Writes   []string
+	Declared bool // from the call's reads/writes arguments rather than inferred
+}
+
+// fileReaders read their file operands (or stdin when given none).
+var fileReaders = map[string]bool{
+	"cat": true, "head": true, "tail": true, "wc": true, "less": true, "more": true, "nl": true,
+	"sort": true, "uniq": true, "cut": true, "tac": true, "od": true, "xxd": true, "hexdump": true,
+	"stat": true, "file": true, "ls": true, "du": true, "tree": true, "diff": true, "cmp": true,
+	"md5sum": true, "sha1sum": true, "sha256sum": true, "sha512sum": true, "cksum": true,
+	"jq": true, "yq": true, "realpath": true, "readlink": true, "basename": true, "dirname": true,
+}
+
+// patternReaders take a pattern operand before their files and search the
+// current directory when given no files (rg, ag) or read stdin (grep).
+var patternReaders = map[string]bool{"grep": true, "egrep": true, "fgrep": true, "rg": true, "ag": true, "awk": true}
+
+// noFileAccess neither read nor write project files.
+var noFileAccess = map[string]bool{
+	"echo": true, "printf": true, "true": true, "false": true, "pwd": true, "date": true, "sleep": true,
+	"whoami": true, "uname": true, "env": true, "printenv": true, "which": true, "type": true, "test": true, "[": true,
+	"seq": true, "yes": true, "expr": true, "id": true, "hostname": true,
+	// wrappers and shells: the commands they run are analyzed on their own
+	"nice": true, "nohup": true, "time": true, "command": true, "builtin": true, "exec": true, "stdbuf": true,
+	"ionice": true, "timeout": true, "sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "eval": true,
+}
+
+// wholeTreeReaders may read anything in the project; their writes, if any,
+// are visible to the command analysis.
+var wholeTreeReaders = map[string]bool{"git": true, "find": true, "xargs": true, "gofmt": true, "goimports": true, "staticcheck": true}
+
+// InferCommandEffects returns a run_command call's declared reads and
+// writes when it has them, else what the parsed command line shows.
+// Yields: ok=false when the effects are unknown; the call is then a barrier.
+func InferCommandEffects(rawArgs string) (CommandEffects, bool) {
+	var args struct {
+		Cmd    string   `json:"cmd"`
+		Reads  []string `json:"reads"`
+		Writes []string `json:"writes"`
+	}
+	if err := json.Unmarshal([]byte(rawArgs), &args); err != nil {
+		return CommandEffects{}, false
+	}
+	if args.Reads != nil || args.Writes != nil {
+		return CommandEffects{Reads: cleanRels(args.Reads), Writes: cleanRels(args.Writes), Declared: true}, true
+	}
+	an, err := AnalyzeCommand(args.Cmd)
+	if err != nil || len(an.ExecPaths) > 0 {
+		return CommandEffects{}, false // scripts and inline code can touch anything
+	}
+	eff := CommandEffects{Reads: an.ReadPaths}
+	for _, c := range an.Calls {
+		reads, ok := callReads(c)
+		if !ok {
+			return CommandEffects{}, false
+		}
+		eff.Reads = append(eff.Reads, reads...)
+	}
+	eff.Reads = cleanRels(eff.Reads)
+	eff.Writes = cleanRels(an.WritePaths)
+	return eff, true
+}
+
+// CommandReads lists the paths an analyzed command line visibly reads:
+// input redirects and the file operands of programs whose arguments are
+// understood. Paths are as written (relative to the working directory or
+// absolute); programs with unknown effects contribute nothing.
+// Flow: checked against paths.deny and paths.read by Policy.Check().
+func CommandReads(an *CommandAnalysis) []string {
+	reads := slices.Clone(an.ReadPaths)
+	for _, c := range an.Calls {
+		if r, ok := callReads(c); ok {
+			reads = append(reads, r...)
+		}
+	}
+	return reads
+}
+
+// callReads infers the project paths one program invocation reads.
+func callReads(c ShellCall) ([]string, bool) {
+	name := path.Base(c.Program)
+	files := nonFlags(c.Args)
+	switch {
+	case noFileAccess[name]:
+		return nil, true
+	case fileReaders[name]:
+		return files, true
+	case patternReaders[name]:
+		if len(files) > 0 && !hasFlagPrefix(c.Args, "-e") && !hasFlagPrefix(c.Args, "-f") {
+			files = files[1:] // pattern operand
+		}
+		recursive := name == "rg" || name == "ag" || hasFlagPrefix(c.Args, "-r") || hasFlagPrefix(c.Args, "-R")
+		if len(files) == 0 && recursive {
+			files = []string{"."}
+		}
+		return files, true
+	case name == "go":
+		return goReads(c.Args)
+	case wholeTreeReaders[name]:
+		return []string{"."}, true
+	}
+	return nil, false
+}
+
+// goReads maps go subcommand package patterns to directories: ./x/... and
+// ./x read x; anything else (module paths, no packages) reads the tree.
+// go run, generate and tool execute arbitrary code, so their effects are unknown.
+func goReads(args []string) ([]string, bool) {
+	operands := nonFlags(args)
+	if len(operands) == 0 {
+		return []string{"."}, true
+	}
+	switch operands[0] {
+	case "run", "generate", "tool", "exec":
+		return nil, false
+	case "version", "env", "help":
+		return nil, true
+	}
+	var out []string
+	for _, a := range operands[1:] {
+		if a == "." || a == "./..." || !strings.HasPrefix(a, "./") {
+			return []string{"."}, true
+		}
+		out = append(out, strings.TrimSuffix(a, "/..."))
+	}
+	if len(out) == 0 {
+		return []string{"."}, true
+	}
+	return out, true
+}
+
+// cleanRels normalizes relative paths; absolute ones and paths leaving the
+// tree become "." so they still conflict with everything.
+func cleanRels(ps []string) []string {
+	out := make([]string, 0, len(ps))
+	for _, p := range ps {
+		p = path.Clean(filepath.ToSlash(p))
+		if path.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") {
+			p = "."
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// CheckDeclaredWrites refuses a command whose visible writes fall outside
+// the writes it declared, since the planner relied on them.
+// Flow: called by run_command after the command is analyzed.
+func CheckDeclaredWrites(an *CommandAnalysis, declared []string) error {
+	for _, w := range cleanRels(an.WritePaths) {
+		covered := false
+		for _, d := range cleanRels(declared) {
+			if d == "." || w == d || strings.HasPrefix(w, d+"/") {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return fmt.Errorf("command writes %s, which is not in its declared writes %v; declare it or omit reads/writes", w, declared)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package pkg
+
+import (
+	"slices"
+	"strings"
+)
+
+// defaultEnvAllow is what run_command inherits when the policy does not say
+// otherwise: locale, shell basics and toolchain settings, never credentials.
+var defaultEnvAllow = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "LANG", "LANGUAGE", "LC_*", "TZ",
+	"GOPATH", "GOCACHE", "GOMODCACHE", "GOROOT", "GOFLAGS", "GOPROXY", "GOPRIVATE", "GONOPROXY", "GONOSUMDB", "GOSUMDB", "GOTOOLCHAIN", "GOOS", "GOARCH", "GOAMD64", "CGO_ENABLED", "CC", "CXX",
+	"NODE_ENV", "NPM_CONFIG_CACHE", "PYTHONPATH", "VIRTUAL_ENV", "CARGO_HOME", "RUSTUP_HOME",
+	"GIT_AUTHOR_NAME", "GIT_AUTHOR_EMAIL", "GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL",
+	"CI", "GITHUB_ACTIONS", "GITHUB_WORKSPACE", "GITHUB_REF", "GITHUB_SHA", "RUNNER_OS", "RUNNER_TEMP",
+}
+
+// ScrubEnv keeps the KEY=VALUE entries of env whose names match allow
+// (exact names, or prefixes written as "LC_*").
+// Flow: called by runCommand before a command starts.
+func ScrubEnv(env []string, allow []string) []string {
+	var out []string
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if slices.ContainsFunc(allow, func(a string) bool {
+			if p, ok := strings.CutSuffix(a, "*"); ok {
+				return strings.HasPrefix(name, p)
+			}
+			return a == name
+		}) {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
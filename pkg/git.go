@@ -0,0 +1,122 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// gitExcludes are agent bookkeeping paths never staged or counted as dirty.
+var gitExcludes = []string{":(exclude)" + RunsDir, ":(exclude)" + ApprovalsFile}
+
+// Git drives the local git binary in a working tree (no remote operations).
+// Flow: used by the agent for --git-commit branches and commits.
+type Git struct {
+	Dir string
+}
+
+// run executes git with args, feeding stdin when non-empty.
+func (g Git) run(stdin string, args ...string) (string, error) {
+	c := exec.Command("git", args...)
+	c.Dir = g.Dir
+	if stdin != "" {
+		c.Stdin = strings.NewReader(stdin)
+	}
+	var out, errb bytes.Buffer
+	c.Stdout, c.Stderr = &out, &errb
+	if err := c.Run(); err != nil {
+		return out.String(), fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(errb.String()))
+	}
+	return out.String(), nil
+}
+
+// IsRepo reports whether Dir is inside a git work tree.
+func (g Git) IsRepo() bool {
+	out, err := g.run("", "rev-parse", "--is-inside-work-tree")
+	return err == nil && strings.TrimSpace(out) == "true"
+}
+
+// Dirty reports uncommitted changes (tracked or untracked) under Dir.
+func (g Git) Dirty() (bool, error) {
+	paths, err := g.DirtyPaths()
+	return len(paths) > 0, err
+}
+
+// DirtyPaths lists the files under Dir with staged, unstaged or untracked
+// changes, relative to the top of the work tree (both sides of a rename).
+func (g Git) DirtyPaths() ([]string, error) {
+	out, err := g.run("", append([]string{"status", "--porcelain", "-z", "--untracked-files=all", "--", "."}, gitExcludes...)...)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	entries := strings.Split(out, "\x00")
+	for i := 0; i < len(entries); i++ {
+		e := entries[i]
+		if len(e) < 4 {
+			continue
+		}
+		paths = append(paths, e[3:])
+		if (e[0] == 'R' || e[0] == 'C') && i+1 < len(entries) {
+			i++ // the source path follows
+			paths = append(paths, entries[i])
+		}
+	}
+	return paths, nil
+}
+
+// CreateBranch creates and switches to a new branch at HEAD.
+func (g Git) CreateBranch(name string) error {
+	_, err := g.run("", "checkout", "-b", name)
+	return err
+}
+
+// StageAll stages every change under Dir except the skipped paths (from
+// DirtyPaths) and returns the diff Commit would record.
+// Yields: empty diff when there is nothing to commit.
+func (g Git) StageAll(skip ...string) (string, error) {
+	if _, err := g.run("", append([]string{"add", "-A"}, pathspec(skip)...)...); err != nil {
+		return "", err
+	}
+	return g.run("", append([]string{"diff", "--cached", "--no-color"}, pathspec(skip)...)...)
+}
+
+// Commit records the staged changes under Dir, except the skipped paths,
+// with message; anything else already in the index stays staged. The
+// repository's hooks run. A fallback identity is supplied when none is
+// configured.
+func (g Git) Commit(message string, skip ...string) error {
+	args := append([]string{"commit", "-F", "-"}, pathspec(skip)...)
+	if out, _ := g.run("", "config", "user.email"); strings.TrimSpace(out) == "" {
+		args = append([]string{"-c", "user.name=agent", "-c", "user.email=agent@localhost"}, args...)
+	}
+	_, err := g.run(message, args...)
+	return err
+}
+
+// pathspec selects Dir minus agent bookkeeping and the skipped paths, which
+// are relative to the top of the work tree.
+func pathspec(skip []string) []string {
+	spec := append([]string{"--", "."}, gitExcludes...)
+	for _, p := range skip {
+		spec = append(spec, ":(exclude,top,literal)"+p)
+	}
+	return spec
+}
+
+var slugRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// BranchName builds agent/<slug>-<timestamp> from the task prompt.
+func BranchName(prompt string, now time.Time) string {
+	slug := strings.Trim(slugRe.ReplaceAllString(strings.ToLower(prompt), "-"), "-")
+	if len(slug) > 40 {
+		slug = strings.TrimRight(slug[:40], "-")
+	}
+	if slug == "" {
+		slug = "run"
+	}
+	return "agent/" + slug + "-" + now.Format("20060102-150405")
+}
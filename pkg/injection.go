@@ -0,0 +1,64 @@
+package pkg
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// injectionPatterns are phrasings typical of prompt injection: text that
+// addresses the model rather than describing the project. They are
+// deliberately narrow so ordinary READMEs and build logs do not trigger them.
+var injectionPatterns = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"override of previous instructions", regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override)\s+(all\s+|any\s+)?(of\s+)?(the\s+|your\s+)?(previous|prior|above|earlier|preceding|original|system)\s+(instructions|prompts?|rules|directions|guidelines|messages)`)},
+	{"new instructions for the assistant", regexp.MustCompile(`(?i)\b(new|updated|real|actual)\s+instructions\s*:|\byour\s+(new\s+)?(task|instructions|goal)\s+(is|are)\s*(now|:)`)},
+	{"role reassignment", regexp.MustCompile(`(?i)\byou\s+are\s+now\s+(a|an|the|in)\b|\bfrom\s+now\s+on,?\s+you\s+(are|will|must|should)\b|\bact\s+as\s+(a|an)\s+(unrestricted|jailbroken|different)\b`)},
+	{"chat role or template markers", regexp.MustCompile(`(?im)<\|(im_start|im_end|system|assistant|user)\|>|\[/?INST\]|<</?SYS>>|^\s*#{0,3}\s*((system|assistant)\s+(prompt|message)|assistant)\s*:\s*\S`)},
+	{"request to hide actions from the user", regexp.MustCompile(`(?i)\b(do\s+not|don't|never)\s+(tell|inform|alert|notify|mention\s+(this|it)\s+to)\s+the\s+user\b|\bwithout\s+(telling|informing|asking)\s+the\s+user\b`)},
+	{"destructive request", regexp.MustCompile(`(?i)\b(delete|remove|wipe|erase|destroy)\s+(everything|all\s+(the\s+)?files|the\s+(entire|whole)\s+(repo|repository|project|codebase|disk))\b|\brm\s+-(rf|fr)\s+(/|~|\*|/\*)(\s|$)`)},
+	{"credential exfiltration", regexp.MustCompile(`(?i)\b(send|upload|post|exfiltrate|leak|email)\s+(the\s+|all\s+|your\s+)?(secrets?|credentials|api\s+keys?|tokens?|environment\s+variables|env\s+vars|\.env|ssh\s+keys?)\b`)},
+}
+
+// InjectionFinding is one instruction-like passage in untrusted text.
+type InjectionFinding struct {
+	Kind    string
+	Excerpt string
+}
+
+func (f InjectionFinding) String() string {
+	return fmt.Sprintf("%s (%q)", f.Kind, f.Excerpt)
+}
+
+// DetectInjection reports instruction-like content in text that reached the
+// agent from files or commands, at most one finding per kind.
+// Flow: called on read_file and command output before it is shown to the model.
+func DetectInjection(text string) []InjectionFinding {
+	var out []InjectionFinding
+	for _, p := range injectionPatterns {
+		loc := p.re.FindStringIndex(text)
+		if loc == nil {
+			continue
+		}
+		ex := strings.Join(strings.Fields(text[loc[0]:loc[1]]), " ")
+		if len(ex) > 80 {
+			ex = TrimUTF8(ex[:80]) + "..."
+		}
+		out = append(out, InjectionFinding{Kind: p.name, Excerpt: ex})
+	}
+	return out
+}
+
+// WrapUntrusted encloses tool output in an envelope the model is told to
+// treat as data. The nonce is secret per run, so content cannot forge the
+// closing marker; any copy of it inside text is defanged anyway.
+func WrapUntrusted(tool, source, nonce, text string) string {
+	text = strings.ReplaceAll(text, nonce, strings.Repeat("x", len(nonce)))
+	attrs := fmt.Sprintf("tool=%q", tool)
+	if source != "" {
+		attrs += fmt.Sprintf(" source=%q", source)
+	}
+	return fmt.Sprintf("<untrusted-data %s nonce=%q>\n%s\n</untrusted-data nonce=%q>", attrs, nonce, strings.TrimSuffix(text, "\n"), nonce)
+}
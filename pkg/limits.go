@@ -0,0 +1,116 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ProcessLimits cap the resources of one run_command process tree; zero
+// values leave the inherited limit in place.
+type ProcessLimits struct {
+	CPUTime   time.Duration `json:"cpu_time"`   // CPU time per process (RLIMIT_CPU)
+	Memory    int64         `json:"memory"`     // address space per process in bytes (RLIMIT_AS)
+	OpenFiles int           `json:"open_files"` // open file descriptors per process (RLIMIT_NOFILE)
+	Processes int           `json:"processes"`  // processes and threads of the command (RLIMIT_NPROC)
+}
+
+// CappedBuffer keeps the first Head and the last Tail bytes written to it and
+// counts the rest, so a chatty command cannot exhaust the agent's memory.
+// Flow: receives run_command stdout and stderr.
+type CappedBuffer struct {
+	Head int
+	Tail int
+
+	mu    sync.Mutex
+	head  []byte
+	tail  []byte
+	total int64
+}
+
+// Write stores what fits and always reports success so the writer keeps running.
+func (b *CappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.total += int64(len(p))
+	rest := p
+	if room := b.Head - len(b.head); room > 0 {
+		n := min(room, len(rest))
+		b.head = append(b.head, rest[:n]...)
+		rest = rest[n:]
+	}
+	if b.Tail > 0 && len(rest) > 0 {
+		b.tail = append(b.tail, rest...)
+		// trim lazily so steady streams copy at most once per Tail bytes
+		if len(b.tail) > 2*b.Tail {
+			b.tail = append(b.tail[:0], b.tail[len(b.tail)-b.Tail:]...)
+		}
+	}
+	return len(p), nil
+}
+
+// Parts returns the retained head and tail and how many bytes between them
+// were dropped.
+func (b *CappedBuffer) Parts() (head, tail string, omitted int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.tail[max(0, len(b.tail)-b.Tail):]
+	return string(b.head), string(t), b.total - int64(len(b.head)) - int64(len(t))
+}
+
+// Total is the number of bytes written, including dropped ones.
+func (b *CappedBuffer) Total() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.total
+}
+
+// limitMessages are what programs print when an rlimit refuses them.
+var limitMessages = []struct{ limit, text string }{
+	{"memory", "out of memory"},
+	{"memory", "cannot allocate memory"},
+	{"open_files", "too many open files"},
+	{"processes", "resource temporarily unavailable"},
+}
+
+// LimitsHit names the process limits a finished command ran into, judging by
+// its exit state, CPU usage and the messages in its output.
+// Flow: called by runCommand to explain a failed command to the model.
+func LimitsHit(l ProcessLimits, state *os.ProcessState, output string) []string {
+	var hit []string
+	if state != nil && l.CPUTime > 0 {
+		ws, _ := state.Sys().(syscall.WaitStatus)
+		xcpu := (ws.Signaled() && ws.Signal() == syscall.Signal(24)) || state.ExitCode() == 128+24 // SIGXCPU
+		if xcpu || state.UserTime()+state.SystemTime() >= l.CPUTime {
+			hit = append(hit, fmt.Sprintf("cpu_time (%s per process)", l.CPUTime))
+		}
+	}
+	lower := strings.ToLower(output)
+	for _, m := range limitMessages {
+		if !strings.Contains(lower, m.text) {
+			continue
+		}
+		var desc string
+		switch m.limit {
+		case "memory":
+			if l.Memory > 0 {
+				desc = fmt.Sprintf("memory (%d MiB address space per process)", l.Memory>>20)
+			}
+		case "open_files":
+			if l.OpenFiles > 0 {
+				desc = fmt.Sprintf("open_files (%d per process)", l.OpenFiles)
+			}
+		case "processes":
+			if l.Processes > 0 {
+				desc = fmt.Sprintf("processes (%d)", l.Processes)
+			}
+		}
+		if desc != "" && !strings.Contains(strings.Join(hit, ","), m.limit) {
+			hit = append(hit, desc)
+		}
+	}
+	return hit
+}
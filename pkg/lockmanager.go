@@ -35,6 +35,7 @@ func (lm *LockManager) WriteAtomic(filename string, data []byte) error {
 		return err
 	}
 	tmp := f.Name()
+	defer trackTemp(tmp)()
 	_, werr := f.Write(data)
 	serr := f.Sync()
 	cerr := f.Close()
@@ -52,3 +53,23 @@ func (lm *LockManager) WriteAtomic(filename string, data []byte) error {
 	}
 	return os.Rename(tmp, filename)
 }
+
+// inflight holds the temp files of atomic writes not yet renamed into place.
+var inflight sync.Map // abs path -> struct{}
+
+// trackTemp registers a temp file until the returned func is called.
+func trackTemp(path string) func() {
+	inflight.Store(path, struct{}{})
+	return func() { inflight.Delete(path) }
+}
+
+// RemoveTempFiles deletes the temp files of writes still in progress, for
+// a process about to exit without letting them finish.
+// Flow: called by the agent before exiting on a second Ctrl-C.
+func RemoveTempFiles() {
+	inflight.Range(func(k, _ any) bool {
+		_ = os.Remove(k.(string))
+		inflight.Delete(k)
+		return true
+	})
+}
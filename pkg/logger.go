@@ -12,6 +12,19 @@ type Logger struct{
 	enabled bool
 	l *log.Logger
 	devCaller bool
+	redactor *Redactor
+}
+
+// SetRedactor masks secrets in every line the logger prints.
+func (l *Logger) SetRedactor(r *Redactor) {
+	if l == nil { return }
+	l.redactor = r
+}
+
+// redact applies the redactor (if any) to s.
+func (l *Logger) redact(s string) string {
+	if l.redactor == nil { return s }
+	return l.redactor.Redact(s)
 }
 
 
@@ -63,6 +76,7 @@ func (le *LogEntry) Preview(title, content string) {
 
 func (l *Logger) Start(tool, target string) *LogEntry {
 	if l == nil || !l.enabled { return &LogEntry{} }
+	target = l.redact(target)
 	sub := l.l.With("tool", tool, "target", target)
 	sub.Info("start")
 	return &LogEntry{l: l, tool: tool, target: target, start: time.Now(), sub: sub}
@@ -71,18 +85,23 @@ func (l *Logger) Start(tool, target string) *LogEntry {
 func (le *LogEntry) Success(msg string) {
 	if le == nil || le.l == nil || !le.l.enabled { return }
 	d := time.Since(le.start).Truncate(time.Millisecond)
-	le.sub.Info("ok", "dur", d.String(), "msg", msg)
+	le.sub.Info("ok", "dur", d.String(), "msg", le.l.redact(msg))
 }
 
 func (le *LogEntry) Error(err error) {
 	if le == nil || le.l == nil || !le.l.enabled { return }
 	d := time.Since(le.start).Truncate(time.Millisecond)
-	le.sub.Error("error", "dur", d.String(), "err", err)
+	le.sub.Error("error", "dur", d.String(), "err", le.l.redact(err.Error()))
 }
 
 func (l *Logger) Info(msg string) {
 	if l == nil || !l.enabled { return }
-	l.l.Info(msg)
+	l.l.Info(l.redact(msg))
+}
+
+func (l *Logger) Warn(msg string) {
+	if l == nil || !l.enabled { return }
+	l.l.Warn(l.redact(msg))
 }
 
 func (l *Logger) PrintAssistant(content string) {
@@ -90,7 +109,7 @@ func (l *Logger) PrintAssistant(content string) {
 		return
 	}
 	title := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("213")).Render("\n--- ASSISTANT ---")
-	body := lipgloss.NewStyle().Foreground(lipgloss.Color("219")).Render(content)
+	body := lipgloss.NewStyle().Foreground(lipgloss.Color("219")).Render(l.redact(content))
 	if !l.enabled {
 		os.Stdout.WriteString(title + "\n" + body + "\n")
 		return
@@ -99,3 +118,12 @@ func (l *Logger) PrintAssistant(content string) {
 	os.Stderr.WriteString(title + "\n")
 	os.Stderr.WriteString(body + "\n")
 }
+
+// PrintReport writes a titled block (e.g. the change report) to stderr.
+func (l *Logger) PrintReport(title, content string) {
+	if l == nil {
+		return
+	}
+	head := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("81")).Render("\n--- " + title + " ---")
+	os.Stderr.WriteString(head + "\n" + l.redact(content) + "\n")
+}
@@ -0,0 +1,118 @@
+package pkg
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// RunsDir holds per-run artifacts (spilled outputs), relative to --src; git
+// commits made by the agent exclude it.
+const RunsDir = ".agent/runs"
+
+// OutputCapture records one command's output: interleaved head and tail in
+// memory for the model, and complete stdout and stderr in temp files that
+// can be saved as a log.
+// Flow: created by runCommand per call; Save spills, Close discards.
+type OutputCapture struct {
+	Buf *CappedBuffer
+
+	files [2]*os.File
+	max   int64
+}
+
+// NewOutputCapture keeps head and tail bytes in memory and up to maxFile
+// bytes of each stream on disk.
+func NewOutputCapture(head, tail int, maxFile int64) (*OutputCapture, error) {
+	o := &OutputCapture{Buf: &CappedBuffer{Head: head, Tail: tail}, max: maxFile}
+	for i := range o.files {
+		f, err := os.CreateTemp("", "agent-out-*")
+		if err != nil {
+			o.Close()
+			return nil, err
+		}
+		o.files[i] = f
+	}
+	return o, nil
+}
+
+// Stdout is the writer for the command's standard output.
+func (o *OutputCapture) Stdout() io.Writer {
+	return io.MultiWriter(o.Buf, &spillWriter{f: o.files[0], max: o.max})
+}
+
+// Stderr is the writer for the command's standard error.
+func (o *OutputCapture) Stderr() io.Writer {
+	return io.MultiWriter(o.Buf, &spillWriter{f: o.files[1], max: o.max})
+}
+
+// Save writes stdout and stderr as separate sections of one log at path,
+// passing the text through redact first.
+func (o *OutputCapture) Save(path string, redact func(string) string) error {
+	var sb strings.Builder
+	for i, name := range []string{"stdout", "stderr"} {
+		b, err := os.ReadFile(o.files[i].Name())
+		if err != nil {
+			return err
+		}
+		sb.WriteString("==> " + name + " <==\n")
+		sb.Write(b)
+		if len(b) > 0 && b[len(b)-1] != '\n' {
+			sb.WriteString("\n")
+		}
+		if int64(len(b)) >= o.max {
+			sb.WriteString("...[log limit reached, rest discarded]\n")
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(redact(sb.String())), 0o600)
+}
+
+// Close removes the temp files.
+func (o *OutputCapture) Close() {
+	for _, f := range o.files {
+		if f != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}
+}
+
+// spillWriter writes up to max bytes to f and swallows errors, so a full disk
+// never stalls the command.
+type spillWriter struct {
+	f   *os.File
+	max int64
+	n   int64
+}
+
+func (w *spillWriter) Write(p []byte) (int, error) {
+	if room := w.max - w.n; room > 0 {
+		n, _ := w.f.Write(p[:min(int64(len(p)), room)])
+		w.n += int64(n)
+	}
+	return len(p), nil
+}
+
+// TrimUTF8 drops the partial rune a byte cut may leave at either end of s.
+func TrimUTF8(s string) string {
+	for len(s) > 0 {
+		r, n := utf8.DecodeRuneInString(s)
+		if r != utf8.RuneError || n != 1 {
+			break
+		}
+		s = s[1:]
+	}
+	for len(s) > 0 {
+		r, n := utf8.DecodeLastRuneInString(s)
+		if r != utf8.RuneError || n != 1 {
+			break
+		}
+		s = s[:len(s)-1]
+	}
+	return s
+}
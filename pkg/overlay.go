@@ -0,0 +1,256 @@
+package pkg
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// OverlayWorkspace is a copy-on-write Workspace: mutations are staged in
+// memory on top of a read-only base, which is never modified.
+// Flow: wraps the OS backend in --dry-run mode; usable over any backend.
+type OverlayWorkspace struct {
+	root    string
+	base    Workspace
+	mu      sync.RWMutex
+	files   map[string][]byte // path -> staged content
+	deleted map[string]bool   // path -> whiteout hiding the base subtree
+}
+
+// NewOverlayWorkspace constructs an empty overlay over base rooted at root.
+// Flow: called by NewAgent when DryRun is set.
+func NewOverlayWorkspace(root string, base Workspace) *OverlayWorkspace {
+	return &OverlayWorkspace{root: filepath.Clean(root), base: base, files: map[string][]byte{}, deleted: map[string]bool{}}
+}
+
+// ReadFile returns staged content, or the base file when not shadowed.
+func (o *OverlayWorkspace) ReadFile(name string) ([]byte, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if b, ok := o.files[name]; ok {
+		return append([]byte(nil), b...), nil
+	}
+	if o.hiddenLocked(name) || o.isStagedDirLocked(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	return o.base.ReadFile(name)
+}
+
+// WriteFile stages content for name; parents are implied. It fails where a
+// real write would: name is a directory, or an ancestor is a file, in the
+// merged view.
+func (o *OverlayWorkspace) WriteFile(name string, data []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if fi, err := o.statLocked(name); err == nil && fi.IsDir() {
+		return &fs.PathError{Op: "write", Path: name, Err: errors.New("is a directory")}
+	}
+	for p := filepath.Dir(name); isUnder(p, o.root); p = filepath.Dir(p) {
+		if fi, err := o.statLocked(p); err == nil && !fi.IsDir() {
+			return &fs.PathError{Op: "write", Path: name, Err: errors.New("not a directory")}
+		}
+	}
+	o.files[name] = append([]byte(nil), data...)
+	if o.deleted[name] {
+		// the deleted directory's contents stay deleted below the new file
+		if ents, err := o.base.ReadDir(name); err == nil {
+			for _, e := range ents {
+				o.deleted[filepath.Join(name, e.Name())] = true
+			}
+		}
+		delete(o.deleted, name)
+	}
+	return nil
+}
+
+// RemoveAll stages deletion of name and everything below it.
+func (o *OverlayWorkspace) RemoveAll(name string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for p := range o.files {
+		if p == name || isUnder(p, name) {
+			delete(o.files, p)
+		}
+	}
+	o.deleted[name] = true
+	return nil
+}
+
+// Stat describes the merged view of name.
+func (o *OverlayWorkspace) Stat(name string) (fs.FileInfo, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.statLocked(name)
+}
+
+func (o *OverlayWorkspace) statLocked(name string) (fs.FileInfo, error) {
+	if b, ok := o.files[name]; ok {
+		return fileInfo{name: filepath.Base(name), size: int64(len(b))}, nil
+	}
+	if o.isStagedDirLocked(name) {
+		return fileInfo{name: filepath.Base(name), dir: true}, nil
+	}
+	if o.hiddenLocked(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return o.base.Stat(name)
+}
+
+// ReadDir merges base directory entries with staged files and whiteouts.
+func (o *OverlayWorkspace) ReadDir(name string) ([]fs.DirEntry, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	entries := map[string]dirEntry{}
+	baseOK := false
+	if !o.hiddenLocked(name) {
+		if ents, err := o.base.ReadDir(name); err == nil {
+			baseOK = true
+			for _, e := range ents {
+				if o.hiddenLocked(filepath.Join(name, e.Name())) {
+					continue
+				}
+				entries[e.Name()] = dirEntry{name: e.Name(), dir: e.IsDir()}
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	staged := false
+	for p, b := range o.files {
+		if !isUnder(p, name) {
+			continue
+		}
+		staged = true
+		rel, _ := filepath.Rel(name, p)
+		first, rest, _ := strings.Cut(filepath.ToSlash(rel), "/")
+		if rest != "" {
+			entries[first] = dirEntry{name: first, dir: true}
+		} else {
+			entries[first] = dirEntry{name: first, size: int64(len(b))}
+		}
+	}
+	if !baseOK && !staged {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	out := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out, nil
+}
+
+// OverlayChange is one staged file change relative to the base tree.
+type OverlayChange struct {
+	Path    string // slash-separated, relative to the overlay root
+	Before  []byte
+	After   []byte
+	Created bool
+	Deleted bool
+}
+
+// Changes lists every staged file change in path order.
+// Flow: called at the end of a dry run to render the patch.
+func (o *OverlayWorkspace) Changes() []OverlayChange {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	byPath := map[string]OverlayChange{}
+	// deletions: base files under a whiteout that were not re-created
+	for d := range o.deleted {
+		_ = WalkDir(o.base, d, func(p string, e fs.DirEntry, err error) error {
+			if err != nil || e.IsDir() {
+				return nil
+			}
+			if _, staged := o.files[p]; staged {
+				return nil
+			}
+			if before, err := o.base.ReadFile(p); err == nil {
+				byPath[p] = OverlayChange{Path: o.rel(p), Before: before, Deleted: true}
+			}
+			return nil
+		})
+	}
+	for p, after := range o.files {
+		before, err := o.base.ReadFile(p)
+		if err == nil && o.hiddenLocked(p) {
+			// base file was deleted and the path re-created
+			err = fs.ErrNotExist
+		}
+		if err != nil {
+			byPath[p] = OverlayChange{Path: o.rel(p), After: after, Created: true}
+			continue
+		}
+		if string(before) != string(after) {
+			byPath[p] = OverlayChange{Path: o.rel(p), Before: before, After: after}
+		}
+	}
+
+	out := make([]OverlayChange, 0, len(byPath))
+	for _, c := range byPath {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// Patch renders all staged changes as a unified diff (git-style a/ b/ prefixes).
+// Flow: printed or written to --output-patch at the end of a dry run.
+func (o *OverlayWorkspace) Patch() string {
+	var sb strings.Builder
+	for _, c := range o.Changes() {
+		from, to := "a/"+c.Path, "b/"+c.Path
+		if c.Created {
+			from = "/dev/null"
+		}
+		if c.Deleted {
+			to = "/dev/null"
+		}
+		sb.WriteString(UnifiedDiff(from, to, c.Before, c.After, 3))
+	}
+	return sb.String()
+}
+
+// hiddenLocked reports whether name or one of its ancestors was deleted.
+func (o *OverlayWorkspace) hiddenLocked(name string) bool {
+	for p := name; ; p = filepath.Dir(p) {
+		if o.deleted[p] {
+			return true
+		}
+		if p == filepath.Dir(p) || p == o.root {
+			return false
+		}
+	}
+}
+
+// isStagedDirLocked reports whether staged files exist below name.
+func (o *OverlayWorkspace) isStagedDirLocked(name string) bool {
+	for p := range o.files {
+		if isUnder(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *OverlayWorkspace) rel(p string) string {
+	r, err := filepath.Rel(o.root, p)
+	if err != nil {
+		return filepath.ToSlash(p)
+	}
+	return filepath.ToSlash(r)
+}
+
+// isUnder reports whether p is strictly below dir.
+func isUnder(p, dir string) bool {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil || rel == "." || rel == ".." {
+		return false
+	}
+	return !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,174 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// PlanEdge is a must-happen-before constraint between two calls of a turn,
+// with why the planner added it.
+type PlanEdge struct {
+	From, To int
+	Reason   string
+}
+
+// Plan is the planner's view of one turn: the calls, the constraints
+// between them and the phases they run in.
+// Flow: built by PlanPhases(); rendered by `agent plan` and --plan-graph.
+type Plan struct {
+	Turn   int // 0 outside a run
+	Calls  []ToolCallLite
+	Edges  []PlanEdge
+	Phases [][]int
+	Cyclic bool // constraints formed a cycle; calls run one phase in order
+}
+
+// CallLabel names a call by tool and its main argument, e.g.
+// "#2 read_file a/b.txt".
+func CallLabel(i int, c ToolCallLite) string {
+	return fmt.Sprintf("#%d %s", i, CallSummary(c))
+}
+
+// CallSummary is a call's tool and main argument, e.g. "write_file a.txt".
+func CallSummary(c ToolCallLite) string {
+	var args map[string]any
+	_ = json.Unmarshal([]byte(c.FuncArgs), &args)
+	s := ""
+	for _, k := range []string{"path", "dir", "cmd", "id"} {
+		if v, ok := args[k].(string); ok {
+			s = v
+			break
+		}
+	}
+	if len(s) > 60 {
+		s = TrimUTF8(s[:60]) + "..."
+	}
+	return strings.TrimSpace(c.FuncName + " " + s)
+}
+
+// Text renders the phases and edge reasons for a terminal.
+func (p Plan) Text() string {
+	var b strings.Builder
+	if p.Turn > 0 {
+		fmt.Fprintf(&b, "turn %d\n", p.Turn)
+	}
+	for n, layer := range p.Phases {
+		labels := make([]string, len(layer))
+		for k, i := range layer {
+			labels[k] = CallLabel(i, p.Calls[i])
+		}
+		fmt.Fprintf(&b, "phase %d: %s\n", n+1, strings.Join(labels, ", "))
+	}
+	if p.Cyclic {
+		b.WriteString("constraints form a cycle: all calls run in emitted order\n")
+	}
+	if len(p.Edges) == 0 {
+		b.WriteString("edges: none\n")
+		return b.String()
+	}
+	b.WriteString("edges:\n")
+	for _, e := range p.Edges {
+		fmt.Fprintf(&b, "  #%d -> #%d: %s\n", e.From, e.To, e.Reason)
+	}
+	return b.String()
+}
+
+// PlanGraphFormat picks the graph language from a --plan-graph file name.
+// Yields: "dot" for .dot/.gv, "mermaid" for .mmd/.mermaid, else an error.
+func PlanGraphFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".dot", ".gv":
+		return "dot", nil
+	case ".mmd", ".mermaid":
+		return "mermaid", nil
+	}
+	return "", fmt.Errorf("plan graph %q: want a .dot, .gv, .mmd or .mermaid file", path)
+}
+
+// RenderPlans draws each plan's calls grouped by phase, one cluster per
+// turn, with an edge per constraint labelled with its reason.
+// Yields: a single Graphviz (format "dot") or Mermaid graph.
+func RenderPlans(format string, plans []Plan) string {
+	var b strings.Builder
+	if format == "mermaid" {
+		b.WriteString("flowchart TD\n")
+	} else {
+		b.WriteString("digraph plan {\n  rankdir=TB;\n  node [shape=box, fontname=monospace];\n")
+	}
+	for k, p := range plans {
+		turn := p.Turn
+		if turn == 0 {
+			turn = k + 1
+		}
+		node := func(i int) string { return fmt.Sprintf("t%d_c%d", turn, i) }
+		if format == "mermaid" {
+			fmt.Fprintf(&b, "  subgraph t%d[\"turn %d\"]\n", turn, turn)
+			for n, layer := range p.Phases {
+				fmt.Fprintf(&b, "    subgraph t%d_p%d[\"phase %d\"]\n", turn, n+1, n+1)
+				for _, i := range layer {
+					fmt.Fprintf(&b, "      %s[\"%s\"]\n", node(i), mermaidEscape(CallLabel(i, p.Calls[i])))
+				}
+				b.WriteString("    end\n")
+			}
+			b.WriteString("  end\n")
+			for _, e := range p.Edges {
+				fmt.Fprintf(&b, "  %s -->|\"%s\"| %s\n", node(e.From), mermaidEscape(e.Reason), node(e.To))
+			}
+			continue
+		}
+		fmt.Fprintf(&b, "  subgraph cluster_t%d {\n    label=\"turn %d\";\n", turn, turn)
+		for n, layer := range p.Phases {
+			fmt.Fprintf(&b, "    subgraph cluster_t%d_p%d {\n      label=\"phase %d\"; style=dashed;\n", turn, n+1, n+1)
+			for _, i := range layer {
+				fmt.Fprintf(&b, "      %s [label=%q];\n", node(i), CallLabel(i, p.Calls[i]))
+			}
+			b.WriteString("    }\n")
+		}
+		b.WriteString("  }\n")
+		for _, e := range p.Edges {
+			fmt.Fprintf(&b, "  %s -> %s [label=%q];\n", node(e.From), node(e.To), e.Reason)
+		}
+	}
+	if format != "mermaid" {
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+// mermaidEscape makes text safe inside a quoted Mermaid label.
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "\n", " ").Replace(s)
+}
+
+// ParsePlanCalls reads a JSON array of tool calls, each
+// {"id": ..., "name": ..., "arguments": ...} with arguments as an object or
+// a JSON-encoded string (the shape audit logs record).
+// Flow: used by `agent plan` to plan calls without a model.
+func ParsePlanCalls(data []byte) ([]ToolCallLite, error) {
+	var raw []struct {
+		ID        string          `json:"id"`
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("tool calls: %w", err)
+	}
+	calls := make([]ToolCallLite, len(raw))
+	for i, r := range raw {
+		if r.Name == "" {
+			return nil, fmt.Errorf("tool call #%d: missing name", i)
+		}
+		args := "{}"
+		if len(r.Arguments) > 0 && string(r.Arguments) != "null" {
+			args = string(r.Arguments)
+			var s string
+			if json.Unmarshal(r.Arguments, &s) == nil {
+				args = s
+			}
+		}
+		calls[i] = ToolCallLite{ID: r.ID, FuncName: r.Name, FuncArgs: args}
+	}
+	return calls, nil
+}
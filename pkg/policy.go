@@ -0,0 +1,636 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AgentDir holds the agent's per-repo state (policy, approvals, runs),
+// relative to --src.
+const AgentDir = ".agent"
+
+// PolicyFile is the per-repo policy location, relative to --src.
+const PolicyFile = AgentDir + "/policy.yaml"
+
+// ApprovalsFile holds the persisted "always allow" choices (--approve),
+// relative to --src; git commits made by the agent exclude it.
+const ApprovalsFile = AgentDir + "/approvals.json"
+
+// Policy declares which tools, paths and commands a run may use.
+// Flow: resolved by the CLI (ResolvePolicy) and consulted by Agent.Tooling() before every call.
+type Policy struct {
+	Tools    ToolRules     `yaml:"tools"`
+	Paths    PathRules     `yaml:"paths"`
+	Commands CommandRules  `yaml:"commands"`
+	Limits   Limits        `yaml:"limits"`
+	Sandbox  SandboxRules  `yaml:"sandbox"`
+	Env      EnvRules      `yaml:"env"`
+	Secrets  SecretRules   `yaml:"secrets"`
+	Quotas   QuotaRules    `yaml:"quotas"`
+	Schedule ScheduleRules `yaml:"scheduling"`
+}
+
+// ToolRules allow or deny tools by name.
+type ToolRules struct {
+	Allow []string `yaml:"allow"` // empty = every tool
+	Deny  []string `yaml:"deny"`
+}
+
+// PathRules are globs relative to --src; "**" crosses directories.
+type PathRules struct {
+	Read  []string `yaml:"read"`
+	Write []string `yaml:"write"`
+	Deny  []string `yaml:"deny"` // never read or written
+	// Protect are never modified by any tool, whatever paths.write allows.
+	Protect []string `yaml:"protect"`
+	// Symlinks is in-tree (follow links that stay inside --src) or none.
+	Symlinks SymlinkMode `yaml:"symlinks"`
+}
+
+// CommandRules allow or deny run_command programs.
+type CommandRules struct {
+	Allow []CommandRule `yaml:"allow"` // empty = any program not denied
+	Deny  []CommandRule `yaml:"deny"`
+}
+
+// CommandRule matches a program by name and, optionally, its arguments.
+// Args are patterns for the space-joined argument list where "*" matches
+// anything; a rule without Args matches every invocation of Program.
+// In YAML a plain string is shorthand for a rule with only a program.
+type CommandRule struct {
+	Program string   `yaml:"program"`
+	Args    []string `yaml:"args"`
+}
+
+// Limits bound run_command timeouts, captured output and process resources,
+// and how long any other tool call may take.
+type Limits struct {
+	DefaultTimeout time.Duration `yaml:"default_timeout"`
+	MaxTimeout     time.Duration `yaml:"max_timeout"`
+	MaxOutputBytes int           `yaml:"max_output_bytes"`
+
+	// Deadline of one call of a tool that changes nothing (list_dir,
+	// list_dir_recursive, read_file, read_process_output); ToolTimeouts
+	// overrides it per tool. Mutating tools always run to completion and
+	// run_command uses the timeouts above. 0 = none.
+	ToolTimeout  time.Duration            `yaml:"tool_timeout"`
+	ToolTimeouts map[string]time.Duration `yaml:"tool_timeouts"`
+	// Calls taking longer are logged and flagged in the audit log (0 = off).
+	SlowCall time.Duration `yaml:"slow_call"`
+
+	// Per-command rlimits; 0 keeps the agent's own limit.
+	CPUTime        time.Duration `yaml:"cpu_time"`         // per process
+	MaxMemoryBytes int64         `yaml:"max_memory_bytes"` // address space per process
+	MaxOpenFiles   int           `yaml:"max_open_files"`
+	MaxProcesses   int           `yaml:"max_processes"` // processes and threads of one command
+}
+
+// SandboxRules confine run_command processes (Linux: Landlock + namespaces).
+type SandboxRules struct {
+	Mode    SandboxMode `yaml:"mode"`    // auto | required | off
+	Network bool        `yaml:"network"` // keep host networking
+	Read    []string    `yaml:"read"`    // read-only paths besides --src and system dirs; "~" is home
+	Write   []string    `yaml:"write"`   // read-write paths besides --src (build caches)
+}
+
+// EnvRules choose what run_command inherits and which values are masked.
+type EnvRules struct {
+	Allow   []string `yaml:"allow"`   // variable names; "LC_*" matches a prefix
+	Secrets []string `yaml:"secrets"` // extra variables whose values are masked in outputs and logs
+}
+
+// SecretRules control credential scanning of write_file and read_file.
+type SecretRules struct {
+	Writes    string   `yaml:"writes"`    // block | warn | off
+	Reads     string   `yaml:"reads"`     // redact | deny | allow
+	Sensitive []string `yaml:"sensitive"` // files that hold only credentials (.env, id_rsa)
+	Ignore    []string `yaml:"ignore"`    // never scanned, e.g. test fixtures
+}
+
+// QuotaRules cap what one run may do in total; 0 means unlimited. A call
+// over a quota is refused and the run stops after that turn.
+type QuotaRules struct {
+	MaxFilesWritten int            `yaml:"max_files_written"` // distinct files written
+	MaxBytesWritten int64          `yaml:"max_bytes_written"` // write_file content, summed
+	MaxDeletions    int            `yaml:"max_deletions"`     // files removed by delete_path
+	MaxCommands     int            `yaml:"max_commands"`      // run_command and start_process invocations
+	Tools           map[string]int `yaml:"tools"`             // calls per tool name
+}
+
+// ScheduleRules share the run-wide --concurrency pool between tools: a call
+// takes its tool's weight in slots, and at most MaxConcurrent calls of a tool
+// run at once.
+type ScheduleRules struct {
+	Weights       map[string]int `yaml:"weights"`        // slots per call (default 1)
+	MaxConcurrent map[string]int `yaml:"max_concurrent"` // per tool (absent = pool only)
+}
+
+// defaultProtected keep repository metadata, lockfiles, CI, vendored code and
+// the agent's own policy, approvals and run records out of the agent's reach.
+var defaultProtected = []string{".git/**", "**/go.sum", ".github/workflows/**", "vendor/**", AgentDir + "/**"}
+
+// PolicyError is a denial returned to the model as the tool result.
+type PolicyError struct {
+	Rule   string // policy key that decided, e.g. paths.write
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return "policy: " + e.Reason + " (" + e.Rule + ")"
+}
+
+// defaultDeniedPrograms are refused unless a policy overrides commands.deny.
+var defaultDeniedPrograms = []string{"sudo", "su", "doas", "mount", "umount", "iptables", "ifconfig", "ssh", "scp", "sftp", "curl", "wget", "nc", "ncat", "netcat", "socat", "telnet"}
+
+// DefaultPolicy reproduces the built-in behavior when no policy file exists.
+func DefaultPolicy() *Policy {
+	p := &Policy{
+		Paths: PathRules{Read: []string{"**"}, Write: []string{"**"}, Protect: slices.Clone(defaultProtected), Symlinks: SymlinksInTree},
+		Limits: Limits{
+			DefaultTimeout: 60 * time.Second,
+			MaxTimeout:     5 * time.Minute,
+			MaxOutputBytes: 4000,
+			ToolTimeout:    60 * time.Second,
+			SlowCall:       5 * time.Second,
+
+			CPUTime:        5 * time.Minute,
+			MaxMemoryBytes: 8 << 30,
+			MaxOpenFiles:   4096,
+			MaxProcesses:   1024,
+		},
+		Sandbox: SandboxRules{
+			Mode:  SandboxAuto,
+			Read:  []string{"~/go", "~/.gitconfig", "~/.config/git", "~/.profile", "~/.bash_profile", "~/.bash_login", "~/.bashrc"},
+			Write: []string{"~/.cache"},
+		},
+		Env: EnvRules{Allow: slices.Clone(defaultEnvAllow)},
+		Secrets: SecretRules{
+			Writes: "block",
+			Reads:  "redact",
+			Sensitive: []string{"**/.env", "**/.env.*", "**/*.pem", "**/*.key", "**/*.p12", "**/*.pfx",
+				"**/id_rsa", "**/id_dsa", "**/id_ecdsa", "**/id_ed25519", "**/.netrc", "**/.npmrc", "**/.pypirc",
+				"**/.git-credentials", "**/credentials", "**/credentials.json"},
+			Ignore: []string{"**/.env.example", "**/.env.sample", "**/.env.template", "**/testdata/**"},
+		},
+		Quotas: QuotaRules{
+			MaxFilesWritten: 200,
+			MaxBytesWritten: 20 << 20,
+			MaxDeletions:    100,
+			MaxCommands:     300,
+		},
+		Schedule: ScheduleRules{
+			Weights: map[string]int{"run_command": 2},
+		},
+	}
+	for _, prog := range defaultDeniedPrograms {
+		p.Commands.Deny = append(p.Commands.Deny, CommandRule{Program: prog})
+	}
+	return p
+}
+
+var defaultPolicy = DefaultPolicy()
+
+// UnmarshalYAML accepts either a program name or a {program, args} mapping.
+func (r *CommandRule) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		r.Program = n.Value
+		return nil
+	}
+	type plain CommandRule
+	return n.Decode((*plain)(r))
+}
+
+// LoadPolicy reads a policy file; keys it omits keep their defaults.
+func LoadPolicy(path string) (*Policy, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := DefaultPolicy()
+	dec := yaml.NewDecoder(strings.NewReader(string(b)))
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("policy %s: %w", path, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("policy %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// ResolvePolicy loads explicit when set, else <src>/.agent/policy.yaml when
+// present, else the default policy.
+// Yields: the policy and the file it came from ("" for the default).
+func ResolvePolicy(src, explicit string) (*Policy, string, error) {
+	path := explicit
+	if path == "" {
+		path = filepath.Join(src, PolicyFile)
+		if _, err := os.Stat(path); err != nil {
+			return DefaultPolicy(), "", nil
+		}
+	}
+	p, err := LoadPolicy(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return p, path, nil
+}
+
+func (p *Policy) validate() error {
+	for _, r := range append(slices.Clone(p.Commands.Allow), p.Commands.Deny...) {
+		if r.Program == "" {
+			return errors.New("commands: rule without program")
+		}
+	}
+	if p.Paths.Symlinks != SymlinksInTree && p.Paths.Symlinks != SymlinksNone {
+		return fmt.Errorf("paths.symlinks: %q is not one of in-tree, none", p.Paths.Symlinks)
+	}
+	switch p.Sandbox.Mode {
+	case SandboxAuto, SandboxRequired, SandboxOff:
+	default:
+		return fmt.Errorf("sandbox.mode: %q is not one of auto, required, off", p.Sandbox.Mode)
+	}
+	if !slices.Contains([]string{"block", "warn", "off"}, p.Secrets.Writes) {
+		return fmt.Errorf("secrets.writes: %q is not one of block, warn, off", p.Secrets.Writes)
+	}
+	if !slices.Contains([]string{"redact", "deny", "allow"}, p.Secrets.Reads) {
+		return fmt.Errorf("secrets.reads: %q is not one of redact, deny, allow", p.Secrets.Reads)
+	}
+	switch {
+	case p.Limits.DefaultTimeout <= 0, p.Limits.MaxTimeout <= 0:
+		return errors.New("limits: timeouts must be positive")
+	case p.Limits.DefaultTimeout > p.Limits.MaxTimeout:
+		return errors.New("limits: default_timeout exceeds max_timeout")
+	case p.Limits.MaxOutputBytes <= 0:
+		return errors.New("limits: max_output_bytes must be positive")
+	case p.Limits.ToolTimeout < 0, p.Limits.SlowCall < 0:
+		return errors.New("limits: tool_timeout and slow_call cannot be negative")
+	case p.Limits.CPUTime < 0, p.Limits.MaxMemoryBytes < 0, p.Limits.MaxOpenFiles < 0, p.Limits.MaxProcesses < 0:
+		return errors.New("limits: cpu_time, max_memory_bytes, max_open_files and max_processes cannot be negative")
+	case p.Quotas.MaxFilesWritten < 0, p.Quotas.MaxBytesWritten < 0, p.Quotas.MaxDeletions < 0, p.Quotas.MaxCommands < 0:
+		return errors.New("quotas: limits cannot be negative")
+	}
+	for tool, n := range p.Quotas.Tools {
+		if n < 0 {
+			return fmt.Errorf("quotas.tools.%s: cannot be negative", tool)
+		}
+	}
+	for tool, d := range p.Limits.ToolTimeouts {
+		if d < 0 {
+			return fmt.Errorf("limits.tool_timeouts.%s: cannot be negative", tool)
+		}
+	}
+	for tool, n := range p.Schedule.Weights {
+		if n < 1 {
+			return fmt.Errorf("scheduling.weights.%s: must be at least 1", tool)
+		}
+	}
+	for tool, n := range p.Schedule.MaxConcurrent {
+		if n < 1 {
+			return fmt.Errorf("scheduling.max_concurrent.%s: must be at least 1", tool)
+		}
+	}
+	return nil
+}
+
+// or falls back to the default policy for a nil receiver.
+func (p *Policy) or() *Policy {
+	if p == nil {
+		return defaultPolicy
+	}
+	return p
+}
+
+// Check evaluates one tool call against the policy.
+// Flow: called by Tooling() and Review() before a call runs, and by `agent policy check`.
+// Yields: nil when allowed, otherwise a *PolicyError (or a command parse error).
+func (p *Policy) Check(root, name string, args map[string]any) error {
+	p = p.or()
+	if err := p.CheckTool(name); err != nil {
+		return err
+	}
+	str := func(k string) string {
+		if v, ok := args[k]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+	// tool paths are always joined under root, so "/x" means "x"
+	toolPath := func(k string) string {
+		rel := strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(str(k))), "/")
+		if rel == "" {
+			return "."
+		}
+		return rel
+	}
+	switch name {
+	case "list_dir", "list_dir_recursive":
+		return p.CheckPath(toolPath("dir"), false)
+	case "read_file":
+		return p.CheckPath(toolPath("path"), false)
+	case "write_file":
+		return p.CheckPath(toolPath("path"), true)
+	case "delete_path":
+		if err := p.CheckPath(toolPath("path"), true); err != nil {
+			return err
+		}
+		return p.CheckProtectedTree(toolPath("path"))
+	case "run_command", "start_process":
+		an, err := AnalyzeCommand(str("cmd"))
+		if err != nil {
+			return err
+		}
+		if err := p.CheckCommand(an); err != nil {
+			return err
+		}
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+		for _, w := range an.WritePaths {
+			if filepath.IsAbs(w) {
+				if rel, err := filepath.Rel(root, w); err == nil {
+					w = rel
+				}
+			}
+			if err := p.CheckPath(w, true); err != nil {
+				return err
+			}
+		}
+		// reads of the whole tree (".") or outside it are left to the
+		// sandbox, which hides paths.deny matches from every command
+		for _, r := range CommandReads(an) {
+			if filepath.IsAbs(r) {
+				rel, err := filepath.Rel(root, r)
+				if err != nil {
+					continue
+				}
+				r = rel
+			}
+			r = filepath.ToSlash(filepath.Clean(r))
+			if r == "." || r == ".." || strings.HasPrefix(r, "../") {
+				continue
+			}
+			if err := p.CheckPath(r, false); err != nil {
+				return err
+			}
+		}
+		if to := str("timeout"); to != "" {
+			if d, err := time.ParseDuration(to); err == nil && d > p.Limits.MaxTimeout {
+				return &PolicyError{Rule: "limits.max_timeout", Reason: fmt.Sprintf("timeout %s exceeds the maximum of %s", d, p.Limits.MaxTimeout)}
+			}
+		}
+	}
+	return nil
+}
+
+// CheckTool applies tools.allow and tools.deny.
+func (p *Policy) CheckTool(name string) error {
+	p = p.or()
+	if slices.Contains(p.Tools.Deny, name) {
+		return &PolicyError{Rule: "tools.deny", Reason: "tool " + name + " is denied"}
+	}
+	if len(p.Tools.Allow) > 0 && !slices.Contains(p.Tools.Allow, name) {
+		return &PolicyError{Rule: "tools.allow", Reason: fmt.Sprintf("tool %s is not allowed (allowed: %s)", name, strings.Join(p.Tools.Allow, ", "))}
+	}
+	return nil
+}
+
+// CheckPath applies paths.deny, paths.read or paths.write, and for writes
+// paths.protect to a path relative to --src.
+func (p *Policy) CheckPath(rel string, write bool) error {
+	p = p.or()
+	rel = filepath.ToSlash(filepath.Clean(rel))
+	if err := p.CheckDenied(rel); err != nil {
+		return err
+	}
+	rule, globs, verb := "paths.read", p.Paths.Read, "reading"
+	if write {
+		rule, globs, verb = "paths.write", p.Paths.Write, "writing"
+	}
+	if !slices.ContainsFunc(globs, func(g string) bool { return MatchGlob(g, rel) }) {
+		return &PolicyError{Rule: rule, Reason: fmt.Sprintf("%s %s is not allowed (allowed: %s)", verb, rel, strings.Join(globs, ", "))}
+	}
+	if write {
+		return p.CheckProtected(rel)
+	}
+	return nil
+}
+
+// CheckDenied refuses any access to a path matching paths.deny.
+func (p *Policy) CheckDenied(rel string) error {
+	p = p.or()
+	rel = filepath.ToSlash(filepath.Clean(rel))
+	for _, g := range p.Paths.Deny {
+		if MatchGlob(g, rel) {
+			return &PolicyError{Rule: "paths.deny", Reason: fmt.Sprintf("%s matches denied pattern %q", rel, g)}
+		}
+	}
+	return nil
+}
+
+// CheckProtected refuses any change to a path matching paths.protect.
+func (p *Policy) CheckProtected(rel string) error {
+	p = p.or()
+	rel = filepath.ToSlash(filepath.Clean(rel))
+	for _, g := range p.Paths.Protect {
+		if MatchGlob(g, rel) {
+			return &PolicyError{Rule: "paths.protect", Reason: fmt.Sprintf("%s is protected (matches %q) and is never modified; leave it unchanged and continue without it", rel, g)}
+		}
+	}
+	return nil
+}
+
+// CheckCommand applies commands.deny and commands.allow to every program
+// invoked by an analyzed command line, including the programs wrappers
+// (setsid, flock, env -S, ...) and trap actions run; AnalyzeCommand lists
+// them all in an.Calls.
+func (p *Policy) CheckCommand(an *CommandAnalysis) error {
+	p = p.or()
+	for _, call := range an.Calls {
+		prog := filepath.Base(call.Program)
+		for _, r := range p.Commands.Deny {
+			if r.matches(prog, call.Args) {
+				return &PolicyError{Rule: "commands.deny", Reason: "program " + r.String() + " is denied"}
+			}
+		}
+		if len(p.Commands.Allow) == 0 {
+			continue
+		}
+		if !slices.ContainsFunc(p.Commands.Allow, func(r CommandRule) bool { return r.matches(prog, call.Args) }) {
+			return &PolicyError{Rule: "commands.allow", Reason: fmt.Sprintf("%s is not allowed (allowed: %s)", strings.TrimSpace(prog+" "+strings.Join(call.Args, " ")), p.allowedPrograms())}
+		}
+	}
+	return nil
+}
+
+// Timeout resolves a run_command timeout argument: the default when empty or
+// invalid, capped at the maximum.
+func (p *Policy) Timeout(arg string) time.Duration {
+	p = p.or()
+	d, err := time.ParseDuration(arg)
+	if err != nil || d <= 0 {
+		return p.Limits.DefaultTimeout
+	}
+	return min(d, p.Limits.MaxTimeout)
+}
+
+// ToolTimeout is how long one call of tool may run (0 = no deadline), and
+// the policy key that set it.
+func (p *Policy) ToolTimeout(tool string) (time.Duration, string) {
+	p = p.or()
+	if d, ok := p.Limits.ToolTimeouts[tool]; ok {
+		return d, "limits.tool_timeouts." + tool
+	}
+	return p.Limits.ToolTimeout, "limits.tool_timeout"
+}
+
+// SlowCall is the duration above which a tool call is reported as slow
+// (0 = never).
+func (p *Policy) SlowCall() time.Duration {
+	return p.or().Limits.SlowCall
+}
+
+// SymlinkMode is how tool paths treat in-tree symlinks.
+func (p *Policy) SymlinkMode() SymlinkMode {
+	return p.or().Paths.Symlinks
+}
+
+// CheckProtectedTree refuses deleting a directory that holds a path named
+// literally by paths.protect (".github" for ".github/workflows/**"); patterns
+// starting with a wildcard are checked against the tree by the agent.
+func (p *Policy) CheckProtectedTree(rel string) error {
+	p = p.or()
+	rel = filepath.ToSlash(filepath.Clean(rel))
+	for _, g := range p.Paths.Protect {
+		prefix := g[:strings.IndexAny(g+"*", "*?[")]
+		if rel == "." || strings.HasPrefix(prefix, rel+"/") {
+			return &PolicyError{Rule: "paths.protect", Reason: fmt.Sprintf("%s contains protected paths (%q) and cannot be deleted", rel, g)}
+		}
+	}
+	return nil
+}
+
+// ProtectedGlobs returns the paths.protect patterns.
+func (p *Policy) ProtectedGlobs() []string {
+	return p.or().Paths.Protect
+}
+
+// DeniedGlobs returns the paths.deny patterns.
+func (p *Policy) DeniedGlobs() []string {
+	return p.or().Paths.Deny
+}
+
+// SandboxSettings returns the run_command confinement settings.
+func (p *Policy) SandboxSettings() SandboxRules {
+	return p.or().Sandbox
+}
+
+// EnvSettings returns the environment allowlist and extra secret names.
+func (p *Policy) EnvSettings() EnvRules {
+	return p.or().Env
+}
+
+// SecretSettings returns the credential scanning rules.
+func (p *Policy) SecretSettings() SecretRules {
+	return p.or().Secrets
+}
+
+// QuotaSettings returns the per-run quotas.
+func (p *Policy) QuotaSettings() QuotaRules {
+	return p.or().Quotas
+}
+
+// ScheduleSettings returns the tool weights and per-tool concurrency caps.
+func (p *Policy) ScheduleSettings() ScheduleRules {
+	return p.or().Schedule
+}
+
+// OutputLimit is the number of output bytes returned to the model.
+func (p *Policy) OutputLimit() int {
+	return p.or().Limits.MaxOutputBytes
+}
+
+// ProcessLimits returns the rlimits applied to each run_command.
+func (p *Policy) ProcessLimits() ProcessLimits {
+	l := p.or().Limits
+	return ProcessLimits{CPUTime: l.CPUTime, Memory: l.MaxMemoryBytes, OpenFiles: l.MaxOpenFiles, Processes: l.MaxProcesses}
+}
+
+func (p *Policy) allowedPrograms() string {
+	var out []string
+	for _, r := range p.Commands.Allow {
+		out = append(out, r.String())
+	}
+	return strings.Join(out, ", ")
+}
+
+func (r CommandRule) matches(prog string, args []string) bool {
+	if r.Program != prog {
+		return false
+	}
+	if len(r.Args) == 0 {
+		return true
+	}
+	joined := strings.Join(args, " ")
+	return slices.ContainsFunc(r.Args, func(pat string) bool { return matchArgs(pat, joined) })
+}
+
+// String renders the rule as it would be typed, e.g. "git status*".
+func (r CommandRule) String() string {
+	if len(r.Args) == 0 {
+		return r.Program
+	}
+	return r.Program + " " + strings.Join(r.Args, "|")
+}
+
+// MatchGlob reports whether a slash-separated relative path matches pattern.
+// "*" and "?" stay within one path segment, "**" spans any number of them,
+// and "dir/**" also matches dir itself.
+func MatchGlob(pattern, name string) bool {
+	return globRegexp(pattern, false).MatchString(name)
+}
+
+// matchArgs matches an argument string where "*" spans anything, spaces included.
+func matchArgs(pattern, args string) bool {
+	return globRegexp(pattern, true).MatchString(args)
+}
+
+func globRegexp(pattern string, flat bool) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case flat && c == '*':
+			sb.WriteString(".*")
+		case flat && c == '?':
+			sb.WriteString(".")
+		case strings.HasPrefix(pattern[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case pattern[i:] == "/**":
+			sb.WriteString("(?:/.*)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package pkg
+
+import (
+	"os/exec"
+	"time"
+)
+
+// ProcessGroupKill reports whether cancelling a command kills its whole
+// process group, children included; here only the command itself is killed.
+const ProcessGroupKill = false
+
+// setProcessGroup only bounds Wait: there are no process groups to kill.
+func setProcessGroup(c *exec.Cmd) {
+	c.WaitDelay = 2 * time.Second
+}
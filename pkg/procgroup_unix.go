@@ -0,0 +1,22 @@
+//go:build unix
+
+package pkg
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// ProcessGroupKill reports whether cancelling a command kills its whole
+// process group, children included.
+const ProcessGroupKill = true
+
+// setProcessGroup starts c in a process group of its own and makes
+// cancelling it kill the whole group.
+func setProcessGroup(c *exec.Cmd) {
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	c.Cancel = func() error { return syscall.Kill(-c.Process.Pid, syscall.SIGKILL) }
+	// background processes holding the output pipe must not stall Wait
+	c.WaitDelay = 2 * time.Second
+}
@@ -0,0 +1,294 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+)
+
+// processTail is how much recent output each background process keeps.
+const processTail = 1 << 20
+
+// ProcessRegistry tracks background processes started by the agent.
+// Flow: owned by the Agent; start_process adds, stop_process and Run() exit remove.
+type ProcessRegistry struct {
+	mu    sync.Mutex
+	procs map[string]*BackgroundProcess
+	next  int
+	max   int
+}
+
+// BackgroundProcess is one running (or finished) start_process command.
+type BackgroundProcess struct {
+	ID  string
+	Cmd string
+
+	cmd     *exec.Cmd
+	cancel  context.CancelFunc
+	cleanup func()
+	stdin   io.WriteCloser
+	out     *tailBuffer
+	done    chan struct{}
+	err     error // Wait result, valid once done is closed
+}
+
+// NewProcessRegistry constructs a registry allowing up to max live processes.
+func NewProcessRegistry(max int) *ProcessRegistry {
+	return &ProcessRegistry{procs: map[string]*BackgroundProcess{}, max: max}
+}
+
+// Start runs c in the background. cancel must stop c (it is the cancel of
+// the context c was built with); cleanup runs after c exits.
+func (r *ProcessRegistry) Start(label string, c *exec.Cmd, cancel context.CancelFunc, cleanup func()) (*BackgroundProcess, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if live := r.liveLocked(); live >= r.max {
+		return nil, fmt.Errorf("%d background processes already running (max %d); stop one first", live, r.max)
+	}
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	p := &BackgroundProcess{Cmd: label, cmd: c, cancel: cancel, cleanup: cleanup, stdin: stdin, out: &tailBuffer{max: processTail}, done: make(chan struct{})}
+	c.Stdout, c.Stderr = p.out, p.out
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+	r.next++
+	p.ID = fmt.Sprintf("p%d", r.next)
+	r.procs[p.ID] = p
+	go func() {
+		p.err = c.Wait()
+		cancel()
+		if cleanup != nil {
+			cleanup()
+		}
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// Get returns the process with the given id.
+func (r *ProcessRegistry) Get(id string) (*BackgroundProcess, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p, ok := r.procs[id]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("no background process %q (known: %s)", id, r.idsLocked())
+}
+
+// Stop kills a process and its process group and waits for it to exit.
+func (r *ProcessRegistry) Stop(id string) (*BackgroundProcess, error) {
+	p, err := r.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	p.stop()
+	return p, nil
+}
+
+// StopAll kills every process still running.
+// Flow: deferred by Run() and called on interrupt.
+func (r *ProcessRegistry) StopAll() {
+	r.mu.Lock()
+	procs := make([]*BackgroundProcess, 0, len(r.procs))
+	for _, p := range r.procs {
+		procs = append(procs, p)
+	}
+	r.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, p := range procs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.stop()
+		}()
+	}
+	wg.Wait()
+}
+
+func (r *ProcessRegistry) liveLocked() int {
+	n := 0
+	for _, p := range r.procs {
+		if p.Running() {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *ProcessRegistry) idsLocked() string {
+	if len(r.procs) == 0 {
+		return "none"
+	}
+	ids := make([]string, 0, len(r.procs))
+	for id := range r.procs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return fmt.Sprint(ids)
+}
+
+func (p *BackgroundProcess) stop() {
+	p.cancel()
+	<-p.done
+}
+
+// Running reports whether the process has not exited yet.
+func (p *BackgroundProcess) Running() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Wait blocks until the process exits or d elapses; it reports whether it exited.
+func (p *BackgroundProcess) Wait(d time.Duration) bool {
+	select {
+	case <-p.done:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+// Status is "running" or how the process ended.
+func (p *BackgroundProcess) Status() string {
+	if p.Running() {
+		return "running"
+	}
+	if p.err == nil {
+		return "exited (code 0)"
+	}
+	var ee *exec.ExitError
+	if errors.As(p.err, &ee) && ee.Exited() {
+		return fmt.Sprintf("exited (code %d)", ee.ExitCode())
+	}
+	return "exited (" + p.err.Error() + ")"
+}
+
+// WriteInput sends s to the process's stdin; close ends the input stream.
+// A process that stops reading fills the pipe and blocks the write, so it
+// gives up when ctx ends, returning ctx's error and the bytes written.
+func (p *BackgroundProcess) WriteInput(ctx context.Context, s string, close bool) (int, error) {
+	if !p.Running() {
+		return 0, fmt.Errorf("process %s has %s", p.ID, p.Status())
+	}
+	n, err := writeContext(ctx, p.stdin, s)
+	if err != nil {
+		return n, err
+	}
+	if close {
+		return n, p.stdin.Close()
+	}
+	return n, nil
+}
+
+// writeContext writes s to w until done or ctx ends. A pipe that takes
+// deadlines is interrupted in place; any other writer is left to a
+// goroutine that is abandoned, still blocked, when ctx ends.
+func writeContext(ctx context.Context, w io.Writer, s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if d, ok := w.(interface{ SetWriteDeadline(time.Time) error }); ok && d.SetWriteDeadline(time.Time{}) == nil {
+		fired := make(chan struct{})
+		stop := context.AfterFunc(ctx, func() {
+			_ = d.SetWriteDeadline(time.Unix(1, 0))
+			close(fired)
+		})
+		n, err := io.WriteString(w, s)
+		if !stop() {
+			<-fired // clear the deadline only after it was set
+		}
+		_ = d.SetWriteDeadline(time.Time{})
+		if errors.Is(err, os.ErrDeadlineExceeded) && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return n, err
+	}
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		n, err := io.WriteString(w, s)
+		done <- result{n, err}
+	}()
+	select {
+	case r := <-done:
+		return r.n, r.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// Output returns up to max bytes of output starting at cursor (a byte offset
+// into everything the process has written), the cursor to continue from,
+// and how many bytes before cursor were already discarded.
+func (p *BackgroundProcess) Output(cursor int64, max int) (string, int64, int64) {
+	return p.out.read(cursor, max)
+}
+
+// WaitOutput blocks until output past cursor exists, the process exits, d
+// elapses or ctx is cancelled.
+func (p *BackgroundProcess) WaitOutput(ctx context.Context, cursor int64, d time.Duration) {
+	deadline := time.Now().Add(d)
+	for time.Now().Before(deadline) && ctx.Err() == nil && p.Running() && p.out.size() <= cursor {
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// tailBuffer keeps the last max bytes written, addressed by absolute offset.
+type tailBuffer struct {
+	mu   sync.Mutex
+	max  int
+	buf  []byte
+	base int64 // offset of buf[0]
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.max; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+		b.base += int64(over)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) size() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.base + int64(len(b.buf))
+}
+
+func (b *tailBuffer) read(cursor int64, max int) (string, int64, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var dropped int64
+	if cursor < b.base {
+		dropped, cursor = b.base-cursor, b.base
+	}
+	end := b.base + int64(len(b.buf))
+	if cursor > end {
+		cursor = end
+	}
+	from := int(cursor - b.base)
+	to := min(len(b.buf), from+max)
+	return string(b.buf[from:to]), b.base + int64(to), dropped
+}
@@ -0,0 +1,192 @@
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// QuotaError is a call refused because a run-wide quota is used up.
+type QuotaError struct {
+	Rule   string // policy key, e.g. quotas.max_files_written
+	Reason string
+}
+
+func (e *QuotaError) Error() string {
+	return "quota: " + e.Reason + "; the run stops after this turn (" + e.Rule + ")"
+}
+
+// QuotaTracker counts what a run has used against its QuotaRules.
+// Flow: owned by the Agent; charged by Tooling() before each call mutates
+// anything, checked by Run() after every turn.
+type QuotaTracker struct {
+	rules QuotaRules
+
+	mu        sync.Mutex
+	files     map[string]bool
+	bytes     int64
+	deletions int
+	commands  int
+	calls     map[string]int
+	hit       *QuotaError // first refusal
+}
+
+// NewQuotaTracker constructs a tracker with nothing used.
+func NewQuotaTracker(rules QuotaRules) *QuotaTracker {
+	return &QuotaTracker{rules: rules, files: map[string]bool{}, calls: map[string]int{}}
+}
+
+// Call charges one call of tool against quotas.tools.
+func (q *QuotaTracker) Call(tool string) error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if max, ok := q.rules.Tools[tool]; ok && q.calls[tool] >= max {
+		return q.refuseLocked("quotas.tools."+tool, fmt.Sprintf("%s may be called %d times per run", tool, max))
+	}
+	q.calls[tool]++
+	return nil
+}
+
+// Write reserves a write of n bytes to path; rewriting a file counts its
+// bytes again but not the file. The caller holds path's lock and calls
+// refund if the write then fails, so only writes that happened count.
+func (q *QuotaTracker) Write(path string, n int64) (refund func(), err error) {
+	if q == nil {
+		return func() {}, nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if max := q.rules.MaxFilesWritten; max > 0 && !q.files[path] && len(q.files) >= max {
+		return nil, q.refuseLocked("quotas.max_files_written", fmt.Sprintf("%d distinct files already written (max %d)", len(q.files), max))
+	}
+	if max := q.rules.MaxBytesWritten; max > 0 && q.bytes+n > max {
+		return nil, q.refuseLocked("quotas.max_bytes_written", fmt.Sprintf("writing %d bytes would exceed %d bytes per run (%d used)", n, max, q.bytes))
+	}
+	first := !q.files[path]
+	q.files[path] = true
+	q.bytes += n
+	return func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if first {
+			delete(q.files, path)
+		}
+		q.bytes -= n
+	}, nil
+}
+
+// Delete charges the removal of n files.
+func (q *QuotaTracker) Delete(n int) error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if max := q.rules.MaxDeletions; max > 0 && q.deletions+n > max {
+		return q.refuseLocked("quotas.max_deletions", fmt.Sprintf("deleting %d files would exceed %d deletions per run (%d used)", n, max, q.deletions))
+	}
+	q.deletions += n
+	return nil
+}
+
+// Command charges one run_command or start_process invocation.
+func (q *QuotaTracker) Command() error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if max := q.rules.MaxCommands; max > 0 && q.commands >= max {
+		return q.refuseLocked("quotas.max_commands", fmt.Sprintf("%d commands already run (max %d)", q.commands, max))
+	}
+	q.commands++
+	return nil
+}
+
+func (q *QuotaTracker) refuseLocked(rule, reason string) error {
+	err := &QuotaError{Rule: rule, Reason: reason}
+	if q.hit == nil {
+		q.hit = err
+	}
+	return err
+}
+
+// Exceeded returns the first refused call's error, or nil while every call
+// has fit.
+func (q *QuotaTracker) Exceeded() error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.hit == nil {
+		return nil
+	}
+	return q.hit
+}
+
+// Remaining describes the budget left for the quotas a call of tool draws
+// on, e.g. "188 files, 19.2 MiB written"; "" when none apply.
+func (q *QuotaTracker) Remaining(tool string) string {
+	if q == nil {
+		return ""
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var parts []string
+	switch tool {
+	case "write_file":
+		if max := q.rules.MaxFilesWritten; max > 0 {
+			parts = append(parts, fmt.Sprintf("%d files", max-len(q.files)))
+		}
+		if max := q.rules.MaxBytesWritten; max > 0 {
+			parts = append(parts, FormatBytes(max-q.bytes)+" written")
+		}
+	case "delete_path":
+		if max := q.rules.MaxDeletions; max > 0 {
+			parts = append(parts, fmt.Sprintf("%d deletions", max-q.deletions))
+		}
+	case "run_command", "start_process":
+		if max := q.rules.MaxCommands; max > 0 {
+			parts = append(parts, fmt.Sprintf("%d commands", max-q.commands))
+		}
+	}
+	if max, ok := q.rules.Tools[tool]; ok {
+		parts = append(parts, fmt.Sprintf("%d %s calls", max-q.calls[tool], tool))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Usage summarizes what the run used, for logs and reports.
+func (q *QuotaTracker) Usage() string {
+	if q == nil {
+		return ""
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s := fmt.Sprintf("%d files written (%s), %d deletions, %d commands", len(q.files), FormatBytes(q.bytes), q.deletions, q.commands)
+	tools := make([]string, 0, len(q.rules.Tools))
+	for t := range q.rules.Tools {
+		tools = append(tools, t)
+	}
+	sort.Strings(tools)
+	for _, t := range tools {
+		s += fmt.Sprintf(", %d %s calls", q.calls[t], t)
+	}
+	return s
+}
+
+// FormatBytes renders n as B, KiB or MiB.
+func FormatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,101 @@
+package pkg
+
+import (
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// redacted replaces masked text in tool outputs, logs and reports.
+const redacted = "[REDACTED]"
+
+// minSecretLen skips short values ("1", "true") that would mask ordinary text.
+const minSecretLen = 6
+
+// secretNameParts mark an environment variable as holding a secret when one
+// of its _-separated words equals (or ends with) them: API_KEY, GH_TOKEN, APIKEY.
+var secretNameParts = []string{"KEY", "TOKEN", "SECRET", "PASSWORD", "PASSWD", "PASS", "PASSPHRASE", "CREDENTIAL", "CREDENTIALS", "AUTH", "COOKIE", "DSN", "WEBHOOK"}
+
+// secretPatterns match common credential formats wherever they appear.
+// Capture groups, when present, are kept around the mask (e.g. "Bearer ").
+// A pattern only runs when one of its hints occurs in the text, which keeps
+// multi-megabyte command logs cheap to redact.
+var secretPatterns = []struct {
+	re    *regexp.Regexp
+	hints []string // nil = always run
+}{
+	{regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), nil},
+	{regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`), []string{"sk-"}},                                            // OpenAI / Anthropic
+	{regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`), []string{"_"}},        // GitHub
+	{regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}`), []string{"glpat-"}},                                      // GitLab
+	{regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), []string{"AKIA", "ASIA"}},                             // AWS access key id
+	{regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`), []string{"xox"}},                                     // Slack
+	{regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`), []string{"AIza"}},                                           // Google API key
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`), []string{"eyJ"}}, // JWT
+	{regexp.MustCompile(`(?i)(\bbearer\s+)[A-Za-z0-9._~+/=-]{16,}`), nil},
+	{regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+(@)`), nil}, // URL credentials
+}
+
+// Redactor masks secret values and token patterns.
+// Flow: built by Agent.Init() from the process environment; applied to tool
+// results, Logger lines and saved reports.
+type Redactor struct {
+	values []secretValue // longest first so overlapping values mask fully
+}
+
+type secretValue struct {
+	name, value string
+}
+
+// NewRedactor collects values of secret-looking variables in env (KEY=VALUE
+// entries) plus the variables named in extra.
+func NewRedactor(env []string, extra []string) *Redactor {
+	r := &Redactor{}
+	for _, kv := range env {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || len(value) < minSecretLen {
+			continue
+		}
+		if slices.Contains(extra, name) || IsSecretName(name) {
+			r.values = append(r.values, secretValue{name: name, value: value})
+		}
+	}
+	sort.SliceStable(r.values, func(i, j int) bool { return len(r.values[i].value) > len(r.values[j].value) })
+	return r
+}
+
+// IsSecretName reports whether an environment variable name looks like it
+// holds a credential (OPENAI_API_KEY, GITHUB_TOKEN, DB_PASSWORD, ...).
+func IsSecretName(name string) bool {
+	for _, word := range strings.Split(strings.ToUpper(name), "_") {
+		if slices.Contains(secretNameParts, word) || strings.HasSuffix(word, "KEY") || strings.HasSuffix(word, "TOKEN") || strings.HasSuffix(word, "SECRET") {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact masks known secret values and common token patterns in s.
+// A nil Redactor still masks patterns.
+func (r *Redactor) Redact(s string) string {
+	if s == "" {
+		return s
+	}
+	if r != nil {
+		for _, v := range r.values {
+			s = strings.ReplaceAll(s, v.value, "[REDACTED:"+v.name+"]")
+		}
+	}
+	for _, p := range secretPatterns {
+		if p.hints != nil && !slices.ContainsFunc(p.hints, func(h string) bool { return strings.Contains(s, h) }) {
+			continue
+		}
+		if p.re.NumSubexp() == 0 {
+			s = p.re.ReplaceAllLiteralString(s, redacted)
+			continue
+		}
+		s = p.re.ReplaceAllString(s, "${1}"+redacted+"${2}")
+	}
+	return s
+}
@@ -0,0 +1,124 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkMode controls how tool paths treat symlinks found inside --src.
+type SymlinkMode string
+
+const (
+	// SymlinksInTree follows links whose target stays inside --src (default).
+	SymlinksInTree SymlinkMode = "in-tree"
+	// SymlinksNone refuses any path that crosses a symlink.
+	SymlinksNone SymlinkMode = "none"
+)
+
+// maxSymlinks bounds link hops during resolution (as Linux MAXSYMLINKS).
+const maxSymlinks = 40
+
+// ErrOutsideRoot is returned for paths that leave the source directory.
+var ErrOutsideRoot = errors.New("refusing to access outside source directory")
+
+// ResolveInRoot maps a tool path argument to a path inside root, evaluating
+// symlinks one component at a time against the real filesystem.
+// Components that do not exist yet are kept as-is (write targets); the last
+// component is only followed when followLast is set (delete_path removes the
+// link itself).
+// Flow: called by Tooling() for every path argument before locking.
+// Yields: root joined with the resolved relative path, or ErrOutsideRoot.
+func ResolveInRoot(root, rel string, mode SymlinkMode, followLast bool) (string, error) {
+	if rel == "" {
+		return "", errors.New("path required")
+	}
+	joined := filepath.Join(root, filepath.FromSlash(rel))
+	lexical, err := filepath.Rel(root, joined)
+	if err != nil || lexical == ".." || strings.HasPrefix(lexical, ".."+string(filepath.Separator)) {
+		return "", ErrOutsideRoot
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		if realRoot, err = filepath.Abs(root); err != nil {
+			return "", err
+		}
+	}
+	absRoot, _ := filepath.Abs(root)
+
+	var (
+		cur     = realRoot
+		pending = splitPath(lexical)
+		hops    int
+		missing bool
+	)
+	for len(pending) > 0 {
+		c := pending[0]
+		pending = pending[1:]
+		switch c {
+		case "", ".":
+			continue
+		case "..":
+			if cur == realRoot {
+				return "", fmt.Errorf("%w: %s", ErrOutsideRoot, rel)
+			}
+			cur = filepath.Dir(cur)
+			continue
+		}
+		next := filepath.Join(cur, c)
+		if missing {
+			cur = next
+			continue
+		}
+		fi, err := os.Lstat(next)
+		if err != nil {
+			missing = true
+			cur = next
+			continue
+		}
+		if fi.Mode()&fs.ModeSymlink == 0 || (len(pending) == 0 && !followLast) {
+			cur = next
+			continue
+		}
+		linkRel, _ := filepath.Rel(realRoot, next)
+		if mode == SymlinksNone {
+			return "", fmt.Errorf("symlink not followed: %s (policy paths.symlinks: none)", filepath.ToSlash(linkRel))
+		}
+		if hops++; hops > maxSymlinks {
+			return "", fmt.Errorf("too many levels of symbolic links: %s", rel)
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			inside := ""
+			for _, r := range []string{realRoot, absRoot} {
+				if t, err := filepath.Rel(r, filepath.Clean(target)); err == nil && t != ".." && !strings.HasPrefix(t, ".."+string(filepath.Separator)) {
+					inside = t
+					break
+				}
+			}
+			if inside == "" {
+				return "", fmt.Errorf("%w: %s -> %s", ErrOutsideRoot, filepath.ToSlash(linkRel), target)
+			}
+			cur, pending = realRoot, append(splitPath(inside), pending...)
+			continue
+		}
+		pending = append(splitPath(target), pending...)
+	}
+
+	out, err := filepath.Rel(realRoot, cur)
+	if err != nil {
+		return "", ErrOutsideRoot
+	}
+	return filepath.Join(root, out), nil
+}
+
+func splitPath(p string) []string {
+	return strings.Split(filepath.ToSlash(p), "/")
+}
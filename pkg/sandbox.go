@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// SandboxMode selects how run_command processes are confined.
+type SandboxMode string
+
+const (
+	// SandboxAuto confines commands when the kernel supports it and warns otherwise (default).
+	SandboxAuto SandboxMode = "auto"
+	// SandboxRequired refuses to run commands that cannot be confined.
+	SandboxRequired SandboxMode = "required"
+	// SandboxOff runs commands with the agent's own privileges.
+	SandboxOff SandboxMode = "off"
+)
+
+// sandboxEnv carries the JSON SandboxSpec to the re-executed helper.
+const sandboxEnv = "AGENT_SANDBOX_SPEC"
+
+// SandboxSpec is the confinement for one run_command process.
+type SandboxSpec struct {
+	Dir        string   `json:"dir"`         // --src (absolute); also the working directory
+	Read       bool     `json:"read"`        // read files under Dir
+	Write      bool     `json:"write"`       // create, modify and delete under Dir
+	Exec       bool     `json:"exec"`        // execute files under Dir
+	Network    bool     `json:"network"`     // keep host networking
+	ReadPaths  []string `json:"read_paths"`  // extra read-only paths
+	WritePaths []string `json:"write_paths"` // extra read-write paths (caches, TMPDIR)
+	// ReadOnlyPaths under Dir stay read-only even with Write (protected paths).
+	ReadOnlyPaths []string `json:"read_only_paths"`
+	// HiddenPaths under Dir are masked by empty, read-only stand-ins (denied paths).
+	HiddenPaths []string `json:"hidden_paths"`
+
+	// Limits are applied by the helper before exec, confined or not.
+	Limits     ProcessLimits `json:"limits"`
+	Unconfined bool          `json:"unconfined"` // skip Landlock and namespaces, apply Limits only
+}
+
+// SandboxCommand builds `bash -lc cmdline` running in spec.Dir, confined by
+// spec unless mode is off, and always under spec.Limits where supported.
+// Flow: called by runCommand for every command.
+// Yields: the command plus a warning when confinement is missing or partial.
+func SandboxCommand(ctx context.Context, mode SandboxMode, spec SandboxSpec, env []string, cmdline string) (*exec.Cmd, string, error) {
+	args := []string{"bash", "-lc", cmdline}
+	if mode == SandboxOff {
+		return limitCommand(ctx, spec, env, args...)
+	}
+	// programs on PATH (e.g. toolchains under $HOME) stay runnable
+	for _, e := range env {
+		if v, ok := strings.CutPrefix(e, "PATH="); ok {
+			for _, dir := range filepath.SplitList(v) {
+				if filepath.IsAbs(dir) && filepath.Dir(dir) != dir {
+					spec.ReadPaths = append(spec.ReadPaths, dir)
+				}
+			}
+		}
+	}
+	c, warn, err := sandboxCommand(ctx, spec, env, args...)
+	if err != nil {
+		if mode == SandboxRequired {
+			return nil, "", fmt.Errorf("sandbox required but unavailable: %w", err)
+		}
+		c, limitWarn, lerr := limitCommand(ctx, spec, env, args...)
+		if lerr != nil {
+			return nil, "", lerr
+		}
+		return c, strings.TrimSuffix("sandbox unavailable, command runs unconfined: "+err.Error()+"; "+limitWarn, "; "), nil
+	}
+	return c, warn, nil
+}
+
+// SandboxStatus describes what confinement this host supports.
+// Flow: printed by the agent's startup config.
+func SandboxStatus(mode SandboxMode) string {
+	if mode == SandboxOff {
+		return "off"
+	}
+	return string(mode) + ", " + sandboxSupport()
+}
+
+// ExpandHome replaces a leading "~" with the user's home directory.
+func ExpandHome(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, strings.TrimPrefix(p, "~"))
+}
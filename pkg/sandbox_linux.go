@@ -0,0 +1,411 @@
+//go:build linux
+
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// systemReadPaths are readable and executable by every sandboxed command.
+var systemReadPaths = []string{"/bin", "/sbin", "/usr", "/lib", "/lib32", "/lib64", "/libx32", "/etc", "/opt", "/nix", "/proc", "/sys", "/dev", "/run", "/var/lib"}
+
+// deviceWritePaths stay writable so redirects like 2>/dev/null keep working.
+var deviceWritePaths = []string{"/dev/null", "/dev/zero", "/dev/full", "/dev/tty"}
+
+const (
+	llRead = unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_READ_DIR
+	llExec = unix.LANDLOCK_ACCESS_FS_EXECUTE
+	// llFile are the rights the kernel accepts on a non-directory rule.
+	llFile = unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_WRITE_FILE | unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_TRUNCATE | unix.LANDLOCK_ACCESS_FS_IOCTL_DEV
+)
+
+// init turns a re-executed agent binary into the sandbox helper: it applies
+// no_new_privs and Landlock to itself and execs the command, before any
+// agent code runs.
+func init() {
+	raw, ok := os.LookupEnv(sandboxEnv)
+	if !ok {
+		return
+	}
+	// Landlock and no_new_privs are per thread; exec from the thread that holds them.
+	runtime.LockOSThread()
+	os.Unsetenv(sandboxEnv)
+	if raw == "probe" {
+		os.Exit(0)
+	}
+	err := sandboxExec(raw, os.Args[1:])
+	fmt.Fprintln(os.Stderr, "sandbox:", err)
+	os.Exit(126)
+}
+
+// sandboxExec confines the current thread to the spec and replaces the process with args.
+func sandboxExec(raw string, args []string) error {
+	var spec SandboxSpec
+	if err := json.Unmarshal([]byte(raw), &spec); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New("no command")
+	}
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return err
+	}
+	if err := setRlimits(spec.Limits); err != nil {
+		return err
+	}
+	if !spec.Unconfined {
+		abi, err := landlockABI()
+		if err != nil {
+			return err
+		}
+		if err := maskPaths(spec.ReadOnlyPaths, spec.HiddenPaths); err != nil {
+			return err
+		}
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("no_new_privs: %w", err)
+		}
+		if err := landlockRestrict(abi, spec); err != nil {
+			return err
+		}
+	}
+	return unix.Exec(path, args, os.Environ())
+}
+
+// setRlimits lowers the helper's limits before exec; they are inherited by
+// every process the command starts. Limits are never raised above the
+// agent's own hard limits.
+func setRlimits(l ProcessLimits) error {
+	set := func(name string, res int, soft, hard uint64) error {
+		if soft == 0 {
+			return nil
+		}
+		var cur syscall.Rlimit
+		if err := syscall.Getrlimit(res, &cur); err != nil {
+			return fmt.Errorf("rlimit %s: %w", name, err)
+		}
+		// syscall.Setrlimit (not unix) so exec keeps RLIMIT_NOFILE as set here
+		if err := syscall.Setrlimit(res, &syscall.Rlimit{Cur: min(soft, cur.Max), Max: min(hard, cur.Max)}); err != nil {
+			return fmt.Errorf("rlimit %s: %w", name, err)
+		}
+		return nil
+	}
+	// SIGXCPU at the soft limit, SIGKILL a second later
+	cpu := uint64((l.CPUTime + time.Second - 1) / time.Second)
+	if err := set("cpu", unix.RLIMIT_CPU, cpu, cpu+1); err != nil {
+		return err
+	}
+	if err := set("as", unix.RLIMIT_AS, uint64(l.Memory), uint64(l.Memory)); err != nil {
+		return err
+	}
+	if err := set("nofile", unix.RLIMIT_NOFILE, uint64(l.OpenFiles), uint64(l.OpenFiles)); err != nil {
+		return err
+	}
+	return set("nproc", unix.RLIMIT_NPROC, uint64(l.Processes), uint64(l.Processes))
+}
+
+// maskPaths bind-mounts each readOnly path read-only over itself and covers
+// each hidden path with an empty stand-in: a read-only tmpfs for a directory,
+// /dev/null for a file. The helper runs in its own mount namespace, so the
+// host never sees these mounts.
+func maskPaths(readOnly, hidden []string) error {
+	if len(readOnly) == 0 && len(hidden) == 0 {
+		return nil
+	}
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("mount namespace: %w", err)
+	}
+	for _, p := range hidden {
+		var st unix.Stat_t
+		if err := unix.Lstat(p, &st); err != nil {
+			if errors.Is(err, unix.ENOENT) {
+				continue
+			}
+			return fmt.Errorf("hide %s: %w", p, err)
+		}
+		var err error
+		switch st.Mode & unix.S_IFMT {
+		case unix.S_IFDIR:
+			err = unix.Mount("tmpfs", p, "tmpfs", unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "size=4k,mode=0555")
+		case unix.S_IFREG:
+			err = unix.Mount("/dev/null", p, "", unix.MS_BIND, "")
+		default:
+			continue // symlinks are checked through their targets
+		}
+		if err != nil {
+			return fmt.Errorf("hide %s: %w", p, err)
+		}
+	}
+	for _, p := range readOnly {
+		if err := unix.Mount(p, p, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("protect %s: %w", p, err)
+		}
+		// a remount must keep the flags the kernel locked on the original mount
+		var st unix.Statfs_t
+		if err := unix.Statfs(p, &st); err != nil {
+			return fmt.Errorf("protect %s: %w", p, err)
+		}
+		flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT | unix.MS_RDONLY)
+		for sf, ms := range map[int64]uintptr{unix.ST_NOSUID: unix.MS_NOSUID, unix.ST_NODEV: unix.MS_NODEV, unix.ST_NOEXEC: unix.MS_NOEXEC,
+			unix.ST_NOATIME: unix.MS_NOATIME, unix.ST_NODIRATIME: unix.MS_NODIRATIME, unix.ST_RELATIME: unix.MS_RELATIME} {
+			if st.Flags&sf != 0 {
+				flags |= ms
+			}
+		}
+		if err := unix.Mount("", p, "", flags, ""); err != nil {
+			return fmt.Errorf("protect %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// sandboxCommand re-executes the agent binary as the sandbox helper, in new
+// user and network namespaces unless networking is allowed, and in a mount
+// namespace when protected paths must be made read-only or denied ones hidden.
+func sandboxCommand(ctx context.Context, spec SandboxSpec, env []string, args ...string) (*exec.Cmd, string, error) {
+	if _, err := landlockABI(); err != nil {
+		return nil, "", err
+	}
+	var warns []string
+	userns := netnsSupported()
+	if !userns {
+		if !spec.Network {
+			warns = append(warns, "network namespaces unavailable (unprivileged user namespaces disabled?); command keeps host networking")
+		}
+		if spec.Write && len(spec.ReadOnlyPaths) > 0 {
+			warns = append(warns, "mount namespaces unavailable; protected paths are only checked before commands run")
+		}
+		if spec.Limits.Processes > 0 {
+			warns = append(warns, "process count is not limited without user namespaces")
+		}
+		if len(spec.HiddenPaths) > 0 {
+			warns = append(warns, "mount namespaces unavailable; denied paths are only checked before commands run")
+		}
+		spec.ReadOnlyPaths, spec.HiddenPaths, spec.Limits.Processes = nil, nil, 0
+	}
+	if !spec.Write {
+		spec.ReadOnlyPaths = nil
+	}
+	c, err := helperCommand(ctx, spec, env, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	if userns && !spec.Network {
+		setNetns(c.SysProcAttr)
+	}
+	if len(spec.ReadOnlyPaths) > 0 || len(spec.HiddenPaths) > 0 {
+		setUserns(c.SysProcAttr)
+		c.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNS
+	}
+	// RLIMIT_NPROC counts per user namespace: a fresh one limits this command only
+	if spec.Limits.Processes > 0 {
+		setUserns(c.SysProcAttr)
+	}
+	return c, strings.Join(warns, "; "), nil
+}
+
+// limitCommand runs args through the helper with process limits but no
+// confinement (sandbox off or unavailable).
+func limitCommand(ctx context.Context, spec SandboxSpec, env []string, args ...string) (*exec.Cmd, string, error) {
+	spec.Unconfined, spec.ReadOnlyPaths, spec.HiddenPaths = true, nil, nil
+	var warn string
+	if spec.Limits.Processes > 0 && !netnsSupported() {
+		spec.Limits.Processes = 0
+		warn = "process count is not limited without user namespaces"
+	}
+	c, err := helperCommand(ctx, spec, env, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	if spec.Limits.Processes > 0 {
+		setUserns(c.SysProcAttr)
+	}
+	return c, warn, nil
+}
+
+// helperCommand re-executes the agent binary as the helper for spec. The
+// command leads its own process group, so cancellation kills every process
+// it started, not just the shell.
+func helperCommand(ctx context.Context, spec SandboxSpec, env []string, args ...string) (*exec.Cmd, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	c := exec.CommandContext(ctx, exe)
+	c.Args = append([]string{"agent-sandbox"}, args...)
+	c.Dir = spec.Dir
+	if env == nil {
+		env = os.Environ()
+	}
+	c.Env = append(slices.Clone(env), sandboxEnv+"="+string(raw))
+	setProcessGroup(c)
+	c.SysProcAttr.Pdeathsig = syscall.SIGKILL
+	return c, nil
+}
+
+// setNetns runs the child in fresh user and network namespaces.
+func setNetns(attr *syscall.SysProcAttr) {
+	setUserns(attr)
+	attr.Cloneflags |= syscall.CLONE_NEWNET
+}
+
+// setUserns runs the child in a fresh user namespace, mapped to the caller's
+// own uid/gid so file ownership is unchanged.
+func setUserns(attr *syscall.SysProcAttr) {
+	attr.Cloneflags |= syscall.CLONE_NEWUSER
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+	attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+}
+
+var (
+	netnsOnce sync.Once
+	netnsOK   bool
+)
+
+// netnsSupported probes once whether unprivileged namespaces can be created.
+func netnsSupported() bool {
+	netnsOnce.Do(func() {
+		exe, err := os.Executable()
+		if err != nil {
+			return
+		}
+		c := exec.Command(exe)
+		c.Env = []string{sandboxEnv + "=probe"}
+		c.SysProcAttr = &syscall.SysProcAttr{}
+		setNetns(c.SysProcAttr)
+		netnsOK = c.Run() == nil
+	})
+	return netnsOK
+}
+
+// sandboxSupport reports the Landlock ABI and namespace support.
+func sandboxSupport() string {
+	abi, err := landlockABI()
+	if err != nil {
+		return "unavailable (" + err.Error() + ")"
+	}
+	net := "network isolated"
+	if !netnsSupported() {
+		net = "no network namespaces"
+	}
+	return fmt.Sprintf("Landlock ABI v%d, %s", abi, net)
+}
+
+// landlockABI returns the kernel's Landlock ABI version.
+func landlockABI() (int, error) {
+	v, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		switch errno {
+		case unix.ENOSYS:
+			return 0, errors.New("kernel without Landlock")
+		case unix.EOPNOTSUPP:
+			return 0, errors.New("Landlock disabled at boot (add landlock to lsm=)")
+		}
+		return 0, fmt.Errorf("landlock: %w", errno)
+	}
+	return int(v), nil
+}
+
+// landlockFS is every filesystem right the given ABI can restrict.
+func landlockFS(abi int) uint64 {
+	fs := uint64(unix.LANDLOCK_ACCESS_FS_MAKE_SYM<<1 - 1) // ABI 1: EXECUTE .. MAKE_SYM
+	if abi >= 2 {
+		fs |= unix.LANDLOCK_ACCESS_FS_REFER
+	}
+	if abi >= 3 {
+		fs |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+	if abi >= 5 {
+		fs |= unix.LANDLOCK_ACCESS_FS_IOCTL_DEV
+	}
+	return fs
+}
+
+// landlockRestrict denies all filesystem access except the spec's paths.
+func landlockRestrict(abi int, spec SandboxSpec) error {
+	handled := landlockFS(abi)
+	attr := unix.LandlockRulesetAttr{Access_fs: handled}
+	fd, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), 8, 0) // Access_fs only
+	if errno != 0 {
+		return fmt.Errorf("landlock ruleset: %w", errno)
+	}
+	ruleset := int(fd)
+	defer unix.Close(ruleset)
+
+	add := func(path string, access uint64) error {
+		f, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+		if err != nil {
+			if errors.Is(err, unix.ENOENT) || errors.Is(err, unix.EACCES) {
+				return nil
+			}
+			return fmt.Errorf("landlock %s: %w", path, err)
+		}
+		defer unix.Close(f)
+		var st unix.Stat_t
+		if err := unix.Fstat(f, &st); err != nil {
+			return err
+		}
+		if st.Mode&unix.S_IFMT != unix.S_IFDIR {
+			access &= llFile
+		}
+		rule := unix.LandlockPathBeneathAttr{Allowed_access: access & handled, Parent_fd: int32(f)}
+		if _, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(ruleset), unix.LANDLOCK_RULE_PATH_BENEATH, uintptr(unsafe.Pointer(&rule)), 0, 0, 0); errno != 0 {
+			return fmt.Errorf("landlock rule %s: %w", path, errno)
+		}
+		return nil
+	}
+
+	var src uint64
+	if spec.Read || spec.Write {
+		src |= llRead
+	}
+	if spec.Write {
+		src |= handled &^ llExec
+	}
+	if spec.Exec {
+		src |= llRead | llExec
+	}
+	rules := []struct {
+		paths  []string
+		access uint64
+	}{
+		{systemReadPaths, llRead | llExec},
+		{spec.ReadPaths, llRead | llExec},
+		{spec.WritePaths, handled},
+		{deviceWritePaths, llRead | unix.LANDLOCK_ACCESS_FS_WRITE_FILE | unix.LANDLOCK_ACCESS_FS_TRUNCATE},
+		{[]string{spec.Dir}, src},
+	}
+	for _, r := range rules {
+		for _, p := range r.paths {
+			if r.access == 0 {
+				continue
+			}
+			if err := add(p, r.access); err != nil {
+				return err
+			}
+		}
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, uintptr(ruleset), 0, 0); errno != 0 {
+		return fmt.Errorf("landlock restrict: %w", errno)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+//go:build !linux
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"runtime"
+)
+
+// sandboxCommand is unsupported off Linux.
+func sandboxCommand(ctx context.Context, spec SandboxSpec, env []string, args ...string) (*exec.Cmd, string, error) {
+	return nil, "", errors.New("no kernel sandbox on " + runtime.GOOS)
+}
+
+// limitCommand runs args without process limits, which need the Linux
+// helper, but in its own process group where there is one, so a timeout or
+// Ctrl-C kills its children too.
+func limitCommand(ctx context.Context, spec SandboxSpec, env []string, args ...string) (*exec.Cmd, string, error) {
+	c := exec.CommandContext(ctx, args[0], args[1:]...)
+	c.Dir, c.Env = spec.Dir, env
+	setProcessGroup(c)
+	if spec.Limits != (ProcessLimits{}) {
+		return c, "process limits unavailable on " + runtime.GOOS, nil
+	}
+	return c, "", nil
+}
+
+func sandboxSupport() string {
+	return "unavailable on " + runtime.GOOS
+}
@@ -0,0 +1,122 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// Scheduler admits tool calls into a weighted pool of slots shared by every
+// phase of a run, and by every agent given the same Scheduler.
+// Flow: owned by the Agent (or shared by its embedder); RunPhases() acquires
+// a call's slots before running it.
+type Scheduler struct {
+	capacity int64
+	pool     *semaphore.Weighted
+	rules    ScheduleRules
+
+	mu    sync.Mutex
+	tools map[string]*semaphore.Weighted // per-tool caps, created on first use
+}
+
+// NewScheduler constructs a pool of capacity slots (at least one).
+func NewScheduler(capacity int, rules ScheduleRules) *Scheduler {
+	c := int64(max(capacity, 1))
+	return &Scheduler{capacity: c, pool: semaphore.NewWeighted(c), rules: rules, tools: map[string]*semaphore.Weighted{}}
+}
+
+// Weight is the number of slots a call of tool takes, capped at the pool
+// size so a heavy tool still runs (alone) in a small pool.
+func (s *Scheduler) Weight(tool string) int64 {
+	w := int64(1)
+	if n, ok := s.rules.Weights[tool]; ok && n > 0 {
+		w = int64(n)
+	}
+	return min(w, s.capacity)
+}
+
+// Acquire waits for a slot under tool's cap, then for the tool's weight in
+// the pool. Waiters are served in arrival order, so heavy calls are not
+// starved by a stream of light ones.
+// Yields: a release func to call when the call ends, or ctx's error.
+func (s *Scheduler) Acquire(ctx context.Context, tool string) (func(), error) {
+	if s == nil {
+		return func() {}, nil
+	}
+	capped := s.toolSem(tool)
+	if capped != nil {
+		if err := capped.Acquire(ctx, 1); err != nil {
+			return nil, err
+		}
+	}
+	w := s.Weight(tool)
+	if err := s.pool.Acquire(ctx, w); err != nil {
+		if capped != nil {
+			capped.Release(1)
+		}
+		return nil, err
+	}
+	return func() {
+		s.pool.Release(w)
+		if capped != nil {
+			capped.Release(1)
+		}
+	}, nil
+}
+
+func (s *Scheduler) toolSem(tool string) *semaphore.Weighted {
+	n, ok := s.rules.MaxConcurrent[tool]
+	if !ok || n < 1 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tools[tool] == nil {
+		s.tools[tool] = semaphore.NewWeighted(int64(n))
+	}
+	return s.tools[tool]
+}
+
+// String summarizes the pool, e.g. "4 slots; weights run_command=2; max run_command=1".
+func (s *Scheduler) String() string {
+	if s == nil {
+		return "unlimited"
+	}
+	out := fmt.Sprintf("%d slots", s.capacity)
+	if w := formatToolInts(s.rules.Weights); w != "" {
+		out += "; weights " + w
+	}
+	if m := formatToolInts(s.rules.MaxConcurrent); m != "" {
+		out += "; max " + m
+	}
+	return out
+}
+
+// ParseToolInts reads repeatable tool=N flag values, N at least 1.
+// Flow: used by the CLI for --tool-weight and --tool-concurrency.
+func ParseToolInts(flag string, vals []string) (map[string]int, error) {
+	out := map[string]int{}
+	for _, v := range vals {
+		tool, num, ok := strings.Cut(v, "=")
+		n, err := strconv.Atoi(num)
+		if !ok || tool == "" || err != nil || n < 1 {
+			return nil, fmt.Errorf("--%s %q: want tool=N with N >= 1", flag, v)
+		}
+		out[tool] = n
+	}
+	return out, nil
+}
+
+func formatToolInts(m map[string]int) string {
+	parts := make([]string, 0, len(m))
+	for t, n := range m {
+		parts = append(parts, fmt.Sprintf("%s=%d", t, n))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
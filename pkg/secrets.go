@@ -0,0 +1,155 @@
+package pkg
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// SecretFinding is one suspected credential in scanned content.
+type SecretFinding struct {
+	Kind    string // e.g. private-key, aws-access-key, jwt, high-entropy
+	Line    int    // 1-based
+	Preview string // first characters only, never the full value
+	start   int
+	end     int
+}
+
+func (f SecretFinding) String() string {
+	return fmt.Sprintf("line %d: %s (%s)", f.Line, f.Kind, f.Preview)
+}
+
+// secretDetector matches one credential format; group selects the secret
+// part of the match (0 = whole match).
+type secretDetector struct {
+	kind  string
+	re    *regexp.Regexp
+	group int
+	check func(string) bool
+}
+
+var secretDetectors = []secretDetector{
+	{kind: "private-key", re: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY( BLOCK)?-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY( BLOCK)?-----`)},
+	{kind: "aws-access-key", re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{kind: "aws-secret-key", re: regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`), group: 1},
+	{kind: "gcp-service-account", re: regexp.MustCompile(`"private_key_id"\s*:\s*"([0-9a-f]{40})"`), group: 1},
+	{kind: "github-token", re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`)},
+	{kind: "gitlab-token", re: regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}`)},
+	{kind: "slack-token", re: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{kind: "api-key", re: regexp.MustCompile(`\b(?:sk-[A-Za-z0-9_-]{20,}|AIza[0-9A-Za-z_-]{35})`)},
+	{kind: "jwt", re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{kind: "url-password", re: regexp.MustCompile(`://[^/\s:@]+:([^/\s@]{6,})@`), group: 1, check: notPlaceholder},
+	// secret-named assignments: api_key = "...", password: ..., TOKEN=...
+	{kind: "secret-assignment", re: regexp.MustCompile(`(?i)[A-Za-z0-9_.-]*(?:key|token|secret|passw(?:or)?d|pwd|credential|auth)[A-Za-z0-9_.-]*["']?\s*[:=]\s*["']?([^\s"'` + "`" + `,;]{12,})`), group: 1, check: func(s string) bool {
+		return notPlaceholder(s) && strings.ContainsAny(s, "0123456789") && entropy(s) >= 3.5
+	}},
+	{kind: "high-entropy", re: regexp.MustCompile(`[A-Za-z0-9+/_-]{40,}={0,2}`), check: highEntropy},
+}
+
+// ScanSecrets reports suspected credentials in content.
+// Flow: called on write_file content and read_file results.
+func ScanSecrets(content string) []SecretFinding {
+	var found []SecretFinding
+	for _, d := range secretDetectors {
+		for _, m := range d.re.FindAllStringSubmatchIndex(content, -1) {
+			start, end := m[2*d.group], m[2*d.group+1]
+			if start < 0 {
+				continue
+			}
+			val := content[start:end]
+			if d.check != nil && !d.check(val) {
+				continue
+			}
+			if d.kind == "high-entropy" && hashPrefixed(content[:start]) {
+				continue
+			}
+			// detectors run most specific first; later overlapping matches are dropped
+			if slices.ContainsFunc(found, func(f SecretFinding) bool { return start < f.end && f.start < end }) {
+				continue
+			}
+			found = append(found, SecretFinding{Kind: d.kind, Line: strings.Count(content[:start], "\n") + 1, Preview: preview(val), start: start, end: end})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].start < found[j].start })
+	return found
+}
+
+// RedactSecrets replaces every finding with [REDACTED:<kind>].
+func RedactSecrets(content string, findings []SecretFinding) string {
+	var sb strings.Builder
+	last := 0
+	for _, f := range findings {
+		sb.WriteString(content[last:f.start])
+		sb.WriteString("[REDACTED:" + f.Kind + "]")
+		last = f.end
+	}
+	sb.WriteString(content[last:])
+	return sb.String()
+}
+
+var assignmentLine = regexp.MustCompile(`(?m)^(\s*(?:export\s+)?[A-Za-z_][A-Za-z0-9_.-]*\s*[=:]\s*)(\S.*)$`)
+
+// RedactAssignments masks every KEY=VALUE / key: value on its own line, for
+// files that hold nothing but credentials (.env, .netrc, credentials).
+func RedactAssignments(content string) string {
+	return assignmentLine.ReplaceAllString(content, "${1}[REDACTED]")
+}
+
+var placeholderWords = []string{"example", "changeme", "placeholder", "xxxx", "your", "redacted", "dummy", "sample", "<", "${", "{{", "$(", "getenv", "environ", "process.env"}
+
+func notPlaceholder(s string) bool {
+	l := strings.ToLower(s)
+	for _, w := range placeholderWords {
+		if strings.Contains(l, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// highEntropy flags long random-looking tokens, skipping hex digests and
+// identifiers made only of letters.
+func highEntropy(s string) bool {
+	if strings.Trim(s, "0123456789abcdefABCDEF") == "" {
+		return false // hex: commit ids, checksums
+	}
+	if !strings.ContainsAny(s, "0123456789") {
+		return false
+	}
+	return entropy(s) >= 4.5 && notPlaceholder(s)
+}
+
+// hashPrefixed reports checksum notations (go.sum h1:, SRI sha512-) right before a token.
+func hashPrefixed(before string) bool {
+	for _, p := range []string{"h1:", "sha1-", "sha256-", "sha384-", "sha512-", "sha256:", "sha512:"} {
+		if strings.HasSuffix(before, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// entropy is the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	freq := map[rune]float64{}
+	for _, r := range s {
+		freq[r]++
+	}
+	n := float64(len([]rune(s)))
+	var h float64
+	for _, c := range freq {
+		p := c / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+func preview(s string) string {
+	if len(s) <= 4 {
+		return "…"
+	}
+	return s[:4] + "…"
+}
@@ -0,0 +1,756 @@
+package pkg
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// maxShellDepth bounds nested analysis (bash -c, xargs, find -exec, eval).
+const maxShellDepth = 8
+
+// ShellCall is one program invocation found in a command line.
+type ShellCall struct {
+	Program string   // as written, e.g. "go" or "./bin/tool"
+	Args    []string // literal arguments; "" marks a dynamic argument
+}
+
+// CommandAnalysis is the static classification of a run_command line.
+// Flow: produced by AnalyzeCommand(); consumed by run_command permission checks.
+type CommandAnalysis struct {
+	Calls        []ShellCall
+	Writes       bool
+	WriteReasons []string
+	WritePaths   []string // literal paths written; "." when a write cannot be attributed
+	ReadPaths    []string // files read by input redirection
+	ExecPaths    []string // programs/scripts executed by path or interpreted code
+}
+
+// Programs returns the base names of every invoked program.
+func (c *CommandAnalysis) Programs() []string {
+	out := make([]string, 0, len(c.Calls))
+	for _, call := range c.Calls {
+		out = append(out, path.Base(call.Program))
+	}
+	return out
+}
+
+// AnalyzeCommand parses cmdline as bash and classifies every invoked
+// program, redirection and nested command. Constructs whose effect cannot be
+// determined statically (dynamic program names, eval of dynamic strings,
+// bash -c with a computed script, overrides of PATH, LD_*, GIT_* or the
+// pager/editor) are rejected.
+// Flow: called by run_command before execution.
+// Yields: analysis, or an error describing the unanalyzable construct.
+func AnalyzeCommand(cmdline string) (*CommandAnalysis, error) {
+	an := &CommandAnalysis{}
+	if err := an.parse(cmdline, 0); err != nil {
+		return nil, err
+	}
+	return an, nil
+}
+
+func (an *CommandAnalysis) parse(src string, depth int) error {
+	if depth > maxShellDepth {
+		return fmt.Errorf("cannot analyze command: nesting deeper than %d", maxShellDepth)
+	}
+	f, err := syntax.NewParser(syntax.Variant(syntax.LangBash)).Parse(strings.NewReader(src), "")
+	if err != nil {
+		return fmt.Errorf("cannot parse command: %w", err)
+	}
+	var werr error
+	syntax.Walk(f, func(node syntax.Node) bool {
+		if werr != nil {
+			return false
+		}
+		switch n := node.(type) {
+		case *syntax.CallExpr:
+			for _, as := range n.Assigns {
+				if werr = checkAssign(as); werr != nil {
+					return false
+				}
+			}
+			if len(n.Args) > 0 {
+				werr = an.call(n.Args, depth)
+			}
+		case *syntax.DeclClause:
+			for _, as := range n.Args {
+				if werr = checkAssign(as); werr != nil {
+					return false
+				}
+			}
+		case *syntax.Redirect:
+			werr = an.redirect(n)
+		case *syntax.CoprocClause:
+			werr = fmt.Errorf("cannot analyze command: coproc is not supported")
+		}
+		return werr == nil
+	})
+	return werr
+}
+
+// checkAssign rejects variables that change how programs are resolved or loaded.
+func checkAssign(as *syntax.Assign) error {
+	if as.Name == nil || !execEnv(as.Name.Value) {
+		return nil
+	}
+	return fmt.Errorf("cannot analyze command: assignment to %s is not allowed", as.Name.Value)
+}
+
+// execEnv reports whether a variable can make an analyzed program run
+// something else: search paths, preloads, shell startup files, word
+// splitting, and the pagers, editors and hooks git and others spawn.
+func execEnv(name string) bool {
+	switch name {
+	case "PATH", "BASH_ENV", "ENV", "IFS", "PAGER", "EDITOR", "VISUAL", "BASH_ALIASES", "BASH_CMDS":
+		return true
+	}
+	return strings.HasPrefix(name, "LD_") || strings.HasPrefix(name, "GIT_")
+}
+
+// redirect classifies a redirection; output to files is a write.
+func (an *CommandAnalysis) redirect(r *syntax.Redirect) error {
+	switch r.Op {
+	case syntax.RdrOut, syntax.AppOut, syntax.RdrAll, syntax.AppAll, syntax.ClbOut, syntax.RdrInOut:
+	case syntax.DplOut:
+		if target, ok := literal(r.Word); ok && (target == "-" || isDigits(target)) {
+			return nil // fd duplication, e.g. 2>&1
+		}
+	case syntax.RdrIn:
+		if target, ok := literal(r.Word); ok {
+			an.ReadPaths = append(an.ReadPaths, target)
+		} else {
+			an.ReadPaths = append(an.ReadPaths, ".")
+		}
+		return nil
+	default:
+		return nil // heredocs, here-strings
+	}
+	target, ok := literal(r.Word)
+	if !ok {
+		return fmt.Errorf("cannot analyze command: dynamic redirection target")
+	}
+	switch target {
+	case "/dev/null", "/dev/stdout", "/dev/stderr":
+		return nil
+	}
+	an.write("redirect to "+target, target)
+	return nil
+}
+
+// call classifies a program invocation given its argument words.
+func (an *CommandAnalysis) call(words []*syntax.Word, depth int) error {
+	prog, ok := literal(words[0])
+	if !ok {
+		return fmt.Errorf("cannot analyze command: program name is computed at runtime")
+	}
+	args := make([]string, len(words)-1)
+	for i, w := range words[1:] {
+		args[i], _ = literal(w)
+	}
+	an.Calls = append(an.Calls, ShellCall{Program: prog, Args: args})
+	if strings.Contains(prog, "/") {
+		an.ExecPaths = append(an.ExecPaths, prog)
+	}
+	name := path.Base(prog)
+
+	switch name {
+	case "env", "nice", "nohup", "time", "command", "builtin", "exec", "stdbuf", "ionice", "timeout", "xargs", "setsid", "busybox":
+		if name == "command" && lookupOnly(args) {
+			return nil
+		}
+		if name == "env" {
+			script, ok, err := envSplitString(words[1:])
+			if err != nil {
+				return err
+			}
+			if ok {
+				return an.parse(script, depth+1)
+			}
+		}
+		rest, err := skipWrapperArgs(name, words[1:])
+		if err != nil || len(rest) == 0 {
+			return err
+		}
+		return an.call(rest, depth+1)
+	case "flock":
+		// flock [opts] <lock> <command...> | <lock> -c <script> | <fd>
+		rest, err := skipWrapperArgs(name, words[1:])
+		if err != nil || len(rest) < 2 {
+			return err
+		}
+		if a, _ := literal(rest[1]); a == "-c" || a == "--command" {
+			if len(rest) < 3 {
+				return fmt.Errorf("cannot analyze command: flock -c without script")
+			}
+			script, ok := literal(rest[2])
+			if !ok {
+				return fmt.Errorf("cannot analyze command: flock -c with a computed script")
+			}
+			return an.parse(script, depth+1)
+		}
+		return an.call(rest[1:], depth+1)
+	case "watch":
+		// watch runs its arguments joined by spaces through sh -c, unless -x
+		rest, err := skipWrapperArgs(name, words[1:])
+		if err != nil || len(rest) == 0 {
+			return err
+		}
+		if opts := args[:len(args)-len(rest)]; slices.Contains(opts, "-x") || slices.Contains(opts, "--exec") {
+			return an.call(rest, depth+1)
+		}
+		parts, err := literalWords(name, rest)
+		if err != nil {
+			return err
+		}
+		return an.parse(strings.Join(parts, " "), depth+1)
+	case "trap":
+		// the action runs later in this shell, as eval would run it
+		for _, w := range words[1:] {
+			a, ok := literal(w)
+			if !ok {
+				return fmt.Errorf("cannot analyze command: trap of a computed string")
+			}
+			switch {
+			case a == "" || a == "-":
+				return nil // ignore or reset the signals
+			case strings.HasPrefix(a, "-"):
+				continue // -p, -l, --
+			}
+			return an.parse(a, depth+1)
+		}
+		return nil
+	case "alias":
+		for _, a := range args {
+			if a == "" || strings.Contains(a, "=") {
+				return fmt.Errorf("cannot analyze command: alias definitions are not supported")
+			}
+		}
+		return nil
+	case "shopt":
+		if slices.Contains(args, "expand_aliases") && slices.ContainsFunc(args, func(a string) bool {
+			return strings.HasPrefix(a, "-") && !strings.HasPrefix(a, "--") && strings.Contains(a, "s")
+		}) {
+			return fmt.Errorf("cannot analyze command: shopt -s expand_aliases is not supported")
+		}
+		return nil
+	case "sh", "bash", "zsh", "dash", "ksh":
+		for i := 1; i < len(words); i++ {
+			a, ok := literal(words[i])
+			if !ok {
+				return fmt.Errorf("cannot analyze command: dynamic argument to %s", name)
+			}
+			switch {
+			case a == "-o" || a == "+o" || a == "-O" || a == "+O" || a == "--rcfile" || a == "--init-file":
+				i++ // option value
+			case a == "-c" || (strings.HasPrefix(a, "-") && !strings.HasPrefix(a, "--") && strings.Contains(a, "c")):
+				if i+1 >= len(words) {
+					return fmt.Errorf("cannot analyze command: %s -c without script", name)
+				}
+				script, ok := literal(words[i+1])
+				if !ok {
+					return fmt.Errorf("cannot analyze command: %s -c with a computed script", name)
+				}
+				return an.parse(script, depth+1)
+			case !strings.HasPrefix(a, "-") && !strings.HasPrefix(a, "+"):
+				an.ExecPaths = append(an.ExecPaths, a) // script file
+				return nil
+			}
+		}
+		return nil
+	case "eval":
+		var parts []string
+		for _, w := range words[1:] {
+			a, ok := literal(w)
+			if !ok {
+				return fmt.Errorf("cannot analyze command: eval of a computed string")
+			}
+			parts = append(parts, a)
+		}
+		return an.parse(strings.Join(parts, " "), depth+1)
+	case "source", ".":
+		if len(args) > 0 {
+			an.ExecPaths = append(an.ExecPaths, args[0])
+		}
+		return nil
+	case "python", "python3", "node", "ruby", "perl", "php", "lua", "deno", "bun":
+		if interpretsCode(args) {
+			an.ExecPaths = append(an.ExecPaths, name+" "+strings.Join(args, " "))
+		}
+		if name == "perl" && hasFlagPrefix(args, "-i") {
+			an.write("perl -i", nonFlags(args)...)
+		}
+		return nil
+	case "find":
+		return an.find(words[1:], depth)
+	}
+
+	an.classifyWriter(name, args)
+	return nil
+}
+
+// wrapperValueOpts lists wrapper options that take a separate value.
+var wrapperValueOpts = map[string][]string{
+	"env":     {"-u", "-C", "--unset", "--chdir"},
+	"nice":    {"-n"},
+	"timeout": {"-s", "-k", "--signal", "--kill-after"},
+	"xargs":   {"-I", "-n", "-P", "-L", "-d", "-E", "-s", "-a"},
+	"ionice":  {"-c", "-n", "-p"},
+	"exec":    {"-a"},
+	"flock":   {"-w", "-E", "--timeout", "--conflict-exit-code"},
+	"watch":   {"-n", "--interval"},
+}
+
+// lookupOnly reports whether command's options only describe the named
+// program (-v, -V) instead of running it.
+func lookupOnly(args []string) bool {
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") || a == "--" {
+			return false
+		}
+		if strings.ContainsAny(a[1:], "vV") {
+			return true
+		}
+	}
+	return false
+}
+
+// envSplitString finds env -S/--split-string among env's options and returns
+// the command line env runs: the split string followed by the remaining
+// words, quoted.
+func envSplitString(words []*syntax.Word) (string, bool, error) {
+	for i := 0; i < len(words); i++ {
+		a, ok := literal(words[i])
+		if !ok {
+			return "", false, fmt.Errorf("cannot analyze command: dynamic argument to env")
+		}
+		split, found, next := "", false, false
+		switch {
+		case a == "-S" || a == "--split-string":
+			found, next = true, true
+		case strings.HasPrefix(a, "--split-string="):
+			split, found = strings.TrimPrefix(a, "--split-string="), true
+		case a == "--unset" || a == "--chdir":
+			i++
+		case strings.HasPrefix(a, "-") && !strings.HasPrefix(a, "--") && len(a) > 1:
+			// a short cluster; u, C and S take the rest of it or the next word
+			if k := strings.IndexAny(a, "uCS"); k > 0 {
+				if a[k] == 'S' {
+					split, found, next = a[k+1:], true, k == len(a)-1
+				} else if k == len(a)-1 {
+					i++
+				}
+			}
+		case a == "-" || strings.HasPrefix(a, "--"):
+		default:
+			return "", false, nil // assignments or the command: no -S
+		}
+		if !found {
+			continue
+		}
+		if next {
+			if i++; i >= len(words) {
+				return "", false, fmt.Errorf("cannot analyze command: env -S without a command line")
+			}
+			if split, ok = literal(words[i]); !ok {
+				return "", false, fmt.Errorf("cannot analyze command: env -S with a computed command line")
+			}
+		}
+		rest, err := literalWords("env", words[i+1:])
+		if err != nil {
+			return "", false, err
+		}
+		for j, r := range rest {
+			if rest[j], err = syntax.Quote(r, syntax.LangBash); err != nil {
+				return "", false, fmt.Errorf("cannot analyze command: %w", err)
+			}
+		}
+		return strings.TrimSpace(split + " " + strings.Join(rest, " ")), true, nil
+	}
+	return "", false, nil
+}
+
+// literalWords returns the static values of words, refusing dynamic ones.
+func literalWords(name string, words []*syntax.Word) ([]string, error) {
+	out := make([]string, len(words))
+	for i, w := range words {
+		a, ok := literal(w)
+		if !ok {
+			return nil, fmt.Errorf("cannot analyze command: dynamic argument to %s", name)
+		}
+		out[i] = a
+	}
+	return out, nil
+}
+
+// skipWrapperArgs returns the wrapped command words after wrapper options
+// (and env assignments / the timeout duration).
+func skipWrapperArgs(name string, words []*syntax.Word) ([]*syntax.Word, error) {
+	i := 0
+	for ; i < len(words); i++ {
+		a, ok := literal(words[i])
+		if !ok {
+			return nil, fmt.Errorf("cannot analyze command: dynamic argument to %s", name)
+		}
+		if strings.HasPrefix(a, "-") && a != "-" {
+			for _, v := range wrapperValueOpts[name] {
+				if a == v {
+					i++
+				}
+			}
+			continue
+		}
+		if name == "env" && strings.Contains(a, "=") {
+			if n := strings.SplitN(a, "=", 2)[0]; execEnv(n) {
+				return nil, fmt.Errorf("cannot analyze command: assignment to %s is not allowed", n)
+			}
+			continue
+		}
+		if name == "timeout" {
+			i++ // duration operand
+		}
+		break
+	}
+	if i >= len(words) {
+		return nil, nil
+	}
+	return words[i:], nil
+}
+
+// find: -delete/-fprint write; -exec/-execdir/-ok run a nested command.
+func (an *CommandAnalysis) find(words []*syntax.Word, depth int) error {
+	for i := 0; i < len(words); i++ {
+		a, _ := literal(words[i])
+		switch a {
+		case "-delete", "-fprint", "-fprintf", "-fls":
+			an.write("find "+a, ".")
+		case "-exec", "-execdir", "-ok", "-okdir":
+			j := i + 1
+			for j < len(words) {
+				if t, _ := literal(words[j]); t == ";" || t == "+" {
+					break
+				}
+				j++
+			}
+			if j == i+1 {
+				return fmt.Errorf("cannot analyze command: find %s without command", a)
+			}
+			if err := an.call(words[i+1:j], depth+1); err != nil {
+				return err
+			}
+			i = j
+		}
+	}
+	return nil
+}
+
+// classifyWriter marks known mutating programs and subcommands.
+func (an *CommandAnalysis) classifyWriter(name string, args []string) {
+	files := nonFlags(args)
+	switch name {
+	case "rm", "rmdir", "mv", "touch", "mkdir", "chmod", "chown", "chgrp", "unlink", "shred", "truncate", "tee":
+		targets := files
+		if name == "chmod" || name == "chown" || name == "chgrp" {
+			if len(targets) > 0 {
+				targets = targets[1:] // mode/owner operand
+			}
+		}
+		an.write(name, targets...)
+	case "cp", "ln", "install", "rsync":
+		if len(files) > 0 {
+			an.write(name, files[len(files)-1])
+		} else {
+			an.write(name, ".")
+		}
+	case "dd":
+		for _, a := range args {
+			if strings.HasPrefix(a, "of=") {
+				an.write("dd", strings.TrimPrefix(a, "of="))
+			}
+		}
+	case "tar", "unzip", "zip", "gzip", "gunzip", "patch":
+		an.write(name, ".")
+	case "sed":
+		if targets, inPlace := sedFiles(args); inPlace {
+			an.write("sed -i", targets...)
+		}
+	case "sort":
+		for i, a := range args {
+			switch {
+			case (a == "-o" || a == "--output") && i+1 < len(args):
+				an.write("sort -o", args[i+1])
+			case strings.HasPrefix(a, "--output="):
+				an.write("sort -o", strings.TrimPrefix(a, "--output="))
+			case strings.HasPrefix(a, "-o") && len(a) > 2:
+				an.write("sort -o", a[2:])
+			}
+		}
+	case "gofmt", "goimports":
+		if hasFlagPrefix(args, "-w") {
+			an.write(name+" -w", files...)
+		}
+	case "git":
+		sub, rest := gitSubcommand(args)
+		if opt := gitExecOpt(args); opt != "" {
+			// config overrides and diff drivers can run any program
+			an.ExecPaths = append(an.ExecPaths, "git "+opt)
+			an.write("git "+opt, ".")
+		} else if !gitReadOnly(sub, rest) {
+			an.write("git "+sub, ".")
+		}
+	case "go":
+		sub := firstNonFlag(args)
+		switch sub {
+		case "get", "install", "generate", "fmt", "fix", "clean", "work":
+			an.write("go "+sub, ".")
+		case "mod":
+			if op := firstNonFlag(args[1:]); op != "download" && op != "graph" && op != "verify" && op != "why" {
+				an.write("go mod "+op, ".")
+			}
+		case "build", "test":
+			for i, a := range args {
+				if a == "-o" && i+1 < len(args) {
+					an.write("go "+sub+" -o", args[i+1])
+				}
+			}
+		}
+	case "npm", "yarn", "pnpm", "pip", "pip3", "cargo", "make":
+		switch firstNonFlag(args) {
+		case "install", "i", "add", "remove", "uninstall", "update", "upgrade", "ci", "init", "publish", "fmt", "fix", "clean":
+			an.write(name+" "+firstNonFlag(args), ".")
+		}
+	}
+}
+
+// sedFiles returns sed's file operands (all of them when the script comes
+// from -e/-f, else all but the first) and whether it edits them in place.
+func sedFiles(args []string) ([]string, bool) {
+	var files []string
+	script, inPlace := false, false
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--expression" || a == "--file":
+			script = true
+			i++
+		case strings.HasPrefix(a, "--expression=") || strings.HasPrefix(a, "--file="):
+			script = true
+		case a == "--line-length":
+			i++
+		case strings.HasPrefix(a, "--in-place"):
+			inPlace = true
+		case strings.HasPrefix(a, "--"):
+		case strings.HasPrefix(a, "-") && a != "-":
+			// a short cluster; i takes an attached suffix, e, f and l a value
+		cluster:
+			for k := 1; k < len(a); k++ {
+				switch a[k] {
+				case 'i':
+					inPlace = true
+					break cluster
+				case 'e', 'f', 'l':
+					script = script || a[k] != 'l'
+					if k == len(a)-1 {
+						i++
+					}
+					break cluster
+				}
+			}
+		default:
+			files = append(files, a)
+		}
+	}
+	if !script && len(files) > 0 {
+		files = files[1:] // script operand
+	}
+	return files, inPlace
+}
+
+// gitReadOnlySubs are git subcommands that never modify the repository.
+var gitReadOnlySubs = map[string]bool{
+	"": true, "status": true, "log": true, "diff": true, "show": true, "blame": true, "grep": true,
+	"ls-files": true, "ls-tree": true, "rev-parse": true, "describe": true, "shortlog": true,
+	"cat-file": true, "version": true, "help": true, "whatchanged": true, "rev-list": true,
+	"show-ref": true, "for-each-ref": true, "merge-base": true,
+}
+
+// gitSubcommand splits git args into the subcommand and its arguments,
+// skipping global options such as -C <dir>.
+func gitSubcommand(args []string) (string, []string) {
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; {
+		case a == "-C" || a == "-c" || a == "--git-dir" || a == "--work-tree":
+			i++
+		case strings.HasPrefix(a, "-"):
+		default:
+			return a, args[i+1:]
+		}
+	}
+	return "", nil
+}
+
+// gitExecOpt returns the first option that makes any git invocation a
+// possible write or exec: global -c/--config-env (core.pager, aliases,
+// hooks), --exec-path=<dir>, and the diff options --output and --ext-diff.
+func gitExecOpt(args []string) string {
+	global := true
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case global && (a == "-c" || a == "--config-env" || strings.HasPrefix(a, "--config-env=") || strings.HasPrefix(a, "--exec-path=")):
+			return a
+		case a == "--output" || strings.HasPrefix(a, "--output=") || a == "--ext-diff":
+			return a
+		case global && (a == "-C" || a == "--git-dir" || a == "--work-tree"):
+			i++
+		case !strings.HasPrefix(a, "-"):
+			global = false
+		}
+	}
+	return ""
+}
+
+// gitReadOnly reports whether a git subcommand invocation only inspects state.
+func gitReadOnly(sub string, rest []string) bool {
+	if gitReadOnlySubs[sub] {
+		return true
+	}
+	operands := nonFlags(rest)
+	switch sub {
+	case "branch", "tag", "remote":
+		for _, a := range rest {
+			switch a {
+			case "-a", "-r", "-v", "-vv", "-l", "--list", "--all", "--show-current", "--verbose":
+			default:
+				if strings.HasPrefix(a, "-") {
+					return false
+				}
+			}
+		}
+		return len(operands) == 0 || (sub != "remote" && hasFlagPrefix(rest, "--list")) || (sub == "remote" && operands[0] == "show")
+	case "stash":
+		return len(operands) > 0 && (operands[0] == "list" || operands[0] == "show")
+	case "config":
+		return hasFlagPrefix(rest, "--get") || hasFlagPrefix(rest, "--list") || hasFlagPrefix(rest, "-l")
+	case "reflog":
+		return len(operands) == 0 || operands[0] == "show"
+	}
+	return false
+}
+
+func (an *CommandAnalysis) write(reason string, paths ...string) {
+	an.Writes = true
+	an.WriteReasons = append(an.WriteReasons, reason)
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	for _, p := range paths {
+		if p == "" {
+			p = "." // dynamic argument: cannot attribute
+		}
+		an.WritePaths = append(an.WritePaths, p)
+	}
+}
+
+// literal returns the static value of a word (plain, single- or double-quoted
+// text without expansions).
+func literal(w *syntax.Word) (string, bool) {
+	if w == nil {
+		return "", false
+	}
+	var sb strings.Builder
+	for _, part := range w.Parts {
+		switch p := part.(type) {
+		case *syntax.Lit:
+			sb.WriteString(unescape(p.Value, ""))
+		case *syntax.SglQuoted:
+			if p.Dollar {
+				return "", false
+			}
+			sb.WriteString(p.Value)
+		case *syntax.DblQuoted:
+			for _, dp := range p.Parts {
+				lit, ok := dp.(*syntax.Lit)
+				if !ok {
+					return "", false
+				}
+				sb.WriteString(unescape(lit.Value, "$`\"\\\n"))
+			}
+		default:
+			return "", false
+		}
+	}
+	return sb.String(), true
+}
+
+// unescape removes shell backslash escapes; inside double quotes only the
+// characters in special are escapable ("" means any character).
+func unescape(s, special string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && (special == "" || strings.IndexByte(special, s[i+1]) >= 0) {
+			i++
+			if s[i] == '\n' {
+				continue // line continuation
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+func nonFlags(args []string) []string {
+	var out []string
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") || a == "-" {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func firstNonFlag(args []string) string {
+	if f := nonFlags(args); len(f) > 0 {
+		return f[0]
+	}
+	return ""
+}
+
+func hasFlagPrefix(args []string, prefix string) bool {
+	for _, a := range args {
+		if strings.HasPrefix(a, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// interpretsCode reports whether interpreter args run a script or inline code.
+func interpretsCode(args []string) bool {
+	for _, a := range args {
+		switch a {
+		case "--version", "-V", "--help", "-h":
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,33 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ToolTimeoutError is a tool call abandoned at its deadline.
+type ToolTimeoutError struct {
+	Tool  string
+	Limit time.Duration
+	Rule  string // policy key, e.g. limits.tool_timeouts.list_dir_recursive
+}
+
+func (e *ToolTimeoutError) Error() string {
+	return fmt.Sprintf("timeout: %s did not finish within %s (%s); retry on a narrower path or ask the user", e.Tool, e.Limit, e.Rule)
+}
+
+// ParseToolDurations reads repeatable tool=DURATION flag values.
+// Flow: used by the CLI for --tool-timeout.
+func ParseToolDurations(flag string, vals []string) (map[string]time.Duration, error) {
+	out := map[string]time.Duration{}
+	for _, v := range vals {
+		tool, dur, ok := strings.Cut(v, "=")
+		d, err := time.ParseDuration(dur)
+		if !ok || tool == "" || err != nil || d <= 0 {
+			return nil, fmt.Errorf("--%s %q: want tool=DURATION, e.g. list_dir_recursive=2m", flag, v)
+		}
+		out[tool] = d
+	}
+	return out, nil
+}
@@ -16,6 +16,11 @@ type ToolCallLite struct {
 	FuncArgs string
 	PathAbs  string // absolute file path for file ops
 	DirAbs   string // absolute directory for list_dir
+	// run_command: absolute paths read and written; Barrier when unknown
+	Reads   []string
+	Writes  []string
+	Barrier bool
+	After   []int // calls this one waits for, by index (set by PlanPhases)
 }
 
 // AnalyzeLite extracts absolute path and directory for a tool call.
@@ -31,19 +36,25 @@ func AnalyzeLite(root, name, rawArgs string) (absPath, dir string) {
 			clean := filepath.Clean(abs)
 			return clean, filepath.Dir(clean)
 		}
-	case "list_dir":
+	case "list_dir", "list_dir_recursive":
 		d := filepath.FromSlash(fmt.Sprint(a["dir"]))
 		if d == "" {
 			d = "."
 		}
 		abs := filepath.Join(root, d)
 		return "", filepath.Clean(abs)
-	case "run_command":
+	case "run_command", "start_process":
 		return "", root
 	}
 	return "", ""
 }
 
+// PathsOverlap reports whether a and b are the same path or one contains the other.
+// Flow: used by PlanPhases() to find calls that must keep their order.
+func PathsOverlap(a, b string) bool {
+	return a == b || isUnder(a, b) || isUnder(b, a)
+}
+
 // ExtractToolCalls converts SDK tool calls into ToolCallLite slice.
 // Flow: called in Run() immediately after receiving assistant message.
 func ExtractToolCalls(msg openai.ChatCompletionMessage) []ToolCallLite {
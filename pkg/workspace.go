@@ -0,0 +1,269 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Workspace is the filesystem the agent tools operate on.
+// Paths are the cleaned paths produced by Tooling() (source root joined with
+// the relative tool argument).
+// Flow: set during Agent.Init(); every FS tool goes through it.
+type Workspace interface {
+	ReadFile(name string) ([]byte, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Stat(name string) (fs.FileInfo, error)
+	// WriteFile replaces name with data, creating parent directories.
+	WriteFile(name string, data []byte) error
+	// RemoveAll deletes name and everything below it; missing paths are not an error.
+	RemoveAll(name string) error
+}
+
+// OSWorkspace is the real-disk Workspace backend. Every operation opens the
+// source root as a directory handle (os.Root) and works relative to it, so a
+// symlink swapped in after ResolveInRoot still cannot reach outside --src.
+type OSWorkspace struct {
+	root string
+}
+
+// NewOSWorkspace constructs a disk-backed Workspace confined to root.
+// Flow: default backend installed by Agent.Init().
+func NewOSWorkspace(root string) *OSWorkspace {
+	return &OSWorkspace{root: filepath.Clean(root)}
+}
+
+// open returns the root handle and name relative to it.
+func (w *OSWorkspace) open(name string) (*os.Root, string, error) {
+	rel, err := filepath.Rel(w.root, name)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, "", &fs.PathError{Op: "open", Path: name, Err: ErrOutsideRoot}
+	}
+	r, err := os.OpenRoot(w.root)
+	if err != nil {
+		return nil, "", err
+	}
+	return r, rel, nil
+}
+
+func (w *OSWorkspace) ReadFile(name string) ([]byte, error) {
+	r, rel, err := w.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := r.Open(rel)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func (w *OSWorkspace) ReadDir(name string) ([]fs.DirEntry, error) {
+	r, rel, err := w.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := r.Open(rel)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ents, err := f.ReadDir(-1)
+	sort.Slice(ents, func(i, j int) bool { return ents[i].Name() < ents[j].Name() })
+	return ents, err
+}
+
+func (w *OSWorkspace) Stat(name string) (fs.FileInfo, error) {
+	r, rel, err := w.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return r.Stat(rel)
+}
+
+// WriteFile writes a temp file beside name through the root handle, then
+// renames it into place (atomic replace).
+func (w *OSWorkspace) WriteFile(name string, data []byte) error {
+	r, rel, err := w.open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	dir := filepath.Dir(rel)
+	if err := rootMkdirAll(r, dir); err != nil {
+		return err
+	}
+	// the rename goes through the parent's handle, so a symlink swapped into
+	// the path after this point cannot redirect it outside the root
+	parent, err := r.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer parent.Close()
+	tmp := filepath.Join(dir, fmt.Sprintf(".tmp-%d", rand.Uint64()))
+	f, err := r.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	defer trackTemp(filepath.Join(w.root, tmp))()
+	_, werr := f.Write(data)
+	serr := f.Sync()
+	cerr := f.Close()
+	if err := errors.Join(werr, serr, cerr); err != nil {
+		_ = r.Remove(tmp)
+		return err
+	}
+	if err := renameIn(parent, filepath.Base(tmp), filepath.Base(rel)); err != nil {
+		_ = r.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func (w *OSWorkspace) RemoveAll(name string) error {
+	r, rel, err := w.open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if rel == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+	}
+	return rootRemoveAll(r, rel)
+}
+
+// rootMkdirAll creates dir and its parents below r.
+func rootMkdirAll(r *os.Root, dir string) error {
+	if dir == "." {
+		return nil
+	}
+	if fi, err := r.Stat(dir); err == nil {
+		if !fi.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+		}
+		return nil
+	}
+	if err := rootMkdirAll(r, filepath.Dir(dir)); err != nil {
+		return err
+	}
+	if err := r.Mkdir(dir, 0o755); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+// rootRemoveAll deletes name below r without following symlinks.
+func rootRemoveAll(r *os.Root, name string) error {
+	fi, err := r.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		d, err := r.Open(name)
+		if err != nil {
+			return err
+		}
+		ents, err := d.ReadDir(-1)
+		d.Close()
+		if err != nil {
+			return err
+		}
+		for _, e := range ents {
+			if err := rootRemoveAll(r, filepath.Join(name, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	if err := r.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// WalkDir walks the tree rooted at root in lexical order, like filepath.WalkDir.
+// Flow: used by list_dir_recursive and change collection on any backend.
+func WalkDir(ws Workspace, root string, fn fs.WalkDirFunc) error {
+	info, err := ws.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDir(ws, root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+func walkDir(ws Workspace, path string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if errors.Is(err, fs.SkipDir) && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+	ents, err := ws.ReadDir(path)
+	if err != nil {
+		if err = fn(path, d, err); err != nil {
+			if errors.Is(err, fs.SkipDir) {
+				err = nil
+			}
+			return err
+		}
+	}
+	for _, e := range ents {
+		if err := walkDir(ws, filepath.Join(path, e.Name()), e, fn); err != nil {
+			if errors.Is(err, fs.SkipDir) {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// dirEntry is a synthetic fs.DirEntry for in-memory and staged entries.
+type dirEntry struct {
+	name string
+	dir  bool
+	size int64
+}
+
+func (e dirEntry) Name() string { return e.name }
+func (e dirEntry) IsDir() bool  { return e.dir }
+func (e dirEntry) Type() fs.FileMode {
+	if e.dir {
+		return fs.ModeDir
+	}
+	return 0
+}
+func (e dirEntry) Info() (fs.FileInfo, error) { return fileInfo(e), nil }
+
+type fileInfo dirEntry
+
+func (fi fileInfo) Name() string { return fi.name }
+func (fi fileInfo) Size() int64  { return fi.size }
+func (fi fileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0o755
+	}
+	return 0o644
+}
+func (fi fileInfo) ModTime() time.Time { return time.Time{} }
+func (fi fileInfo) IsDir() bool        { return fi.dir }
+func (fi fileInfo) Sys() any           { return nil }
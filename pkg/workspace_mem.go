@@ -0,0 +1,121 @@
+package pkg
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// MemWorkspace is a pure in-memory Workspace for tests and embedding.
+type MemWorkspace struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+	dirs  map[string]bool
+}
+
+// NewMemWorkspace constructs an empty in-memory tree containing only root.
+// Flow: used by library callers and tests in place of the OS backend.
+func NewMemWorkspace(root string) *MemWorkspace {
+	return &MemWorkspace{
+		files: map[string][]byte{},
+		dirs:  map[string]bool{filepath.Clean(root): true},
+	}
+}
+
+// ReadFile returns a copy of the stored content.
+func (m *MemWorkspace) ReadFile(name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	name = filepath.Clean(name)
+	b, ok := m.files[name]
+	if !ok {
+		if m.dirs[name] {
+			return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+		}
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]byte(nil), b...), nil
+}
+
+// ReadDir returns the direct children of name in lexical order.
+func (m *MemWorkspace) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	name = filepath.Clean(name)
+	if !m.dirs[name] {
+		if _, ok := m.files[name]; ok {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+		}
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	var out []fs.DirEntry
+	for d := range m.dirs {
+		if d != name && filepath.Dir(d) == name {
+			out = append(out, dirEntry{name: filepath.Base(d), dir: true})
+		}
+	}
+	for f, b := range m.files {
+		if filepath.Dir(f) == name {
+			out = append(out, dirEntry{name: filepath.Base(f), size: int64(len(b))})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out, nil
+}
+
+// Stat describes a file or directory.
+func (m *MemWorkspace) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	name = filepath.Clean(name)
+	if m.dirs[name] {
+		return fileInfo{name: filepath.Base(name), dir: true}, nil
+	}
+	if b, ok := m.files[name]; ok {
+		return fileInfo{name: filepath.Base(name), size: int64(len(b))}, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// WriteFile stores data, creating parent directories.
+func (m *MemWorkspace) WriteFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if m.dirs[name] {
+		return &fs.PathError{Op: "write", Path: name, Err: errors.New("is a directory")}
+	}
+	for p := filepath.Dir(name); ; p = filepath.Dir(p) {
+		if _, ok := m.files[p]; ok {
+			return &fs.PathError{Op: "mkdir", Path: p, Err: errors.New("not a directory")}
+		}
+		m.dirs[p] = true
+		if p == filepath.Dir(p) {
+			break
+		}
+	}
+	m.files[name] = append([]byte(nil), data...)
+	return nil
+}
+
+// RemoveAll deletes name and its subtree.
+func (m *MemWorkspace) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	delete(m.files, name)
+	delete(m.dirs, name)
+	for f := range m.files {
+		if isUnder(f, name) {
+			delete(m.files, f)
+		}
+	}
+	for d := range m.dirs {
+		if isUnder(d, name) {
+			delete(m.dirs, d)
+		}
+	}
+	return nil
+}
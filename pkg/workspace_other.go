@@ -0,0 +1,15 @@
+//go:build !unix
+
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// renameIn renames oldName to newName inside dir. Without renameat the
+// names are joined onto the directory's path, so a parent swapped for a
+// symlink during the call is not detected here.
+func renameIn(dir *os.File, oldName, newName string) error {
+	return os.Rename(filepath.Join(dir.Name(), oldName), filepath.Join(dir.Name(), newName))
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package pkg
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// renameIn renames oldName to newName, both entries of the open directory
+// dir, without resolving any path above it (os.Root has no Rename before
+// Go 1.25).
+func renameIn(dir *os.File, oldName, newName string) error {
+	fd := int(dir.Fd())
+	if err := unix.Renameat(fd, oldName, fd, newName); err != nil {
+		return &os.LinkError{Op: "renameat", Old: oldName, New: newName, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cds.agents.app/internal/services/agent"
+	"cds.agents.app/pkg"
+)
+
+// scriptedApprover answers approval requests from a fixed list.
+type scriptedApprover struct {
+	answers []agent.Approval
+	seen    []agent.ApprovalRequest
+}
+
+func (s *scriptedApprover) Approve(req agent.ApprovalRequest) (agent.Approval, error) {
+	s.seen = append(s.seen, req)
+	ans := s.answers[0]
+	s.answers = s.answers[1:]
+	return ans, nil
+}
+
+// TestApprovalGate covers deny with reason, edit, and always-allow persistence.
+func TestApprovalGate(t *testing.T) {
+	root := t.TempDir()
+	a := newTestAgent(root)
+	a.Approve = true
+	ap := &scriptedApprover{answers: []agent.Approval{
+		{Reason: "not this file"},
+		{Allow: true, Args: `{"path":"edited.txt","content":"e"}`},
+		{Allow: true, Always: true, Persist: true},
+	}}
+	a.Approver = ap
+
+	// reads are never gated
+	if _, err := a.Review("read_file", `{"path":"x"}`); err != nil {
+		t.Fatalf("read gated: %v", err)
+	}
+	_, err := a.Review("write_file", `{"path":"x.txt","content":"x"}`)
+	if err == nil || !strings.Contains(err.Error(), "not this file") {
+		t.Fatalf("expected denial with reason, got %v", err)
+	}
+	args, err := a.Review("write_file", `{"path":"x.txt","content":"x"}`)
+	if err != nil || !strings.Contains(args, "edited.txt") {
+		t.Fatalf("expected edited args, got %q err=%v", args, err)
+	}
+	if _, err := a.Review("run_command", `{"cmd":"git add -A","permissions":"rw"}`); err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+	if !strings.Contains(ap.seen[0].Preview, "+x") {
+		t.Fatalf("expected diff preview, got %q", ap.seen[0].Preview)
+	}
+
+	// same kind is now allowed without asking, including in a fresh agent via the allowlist
+	if _, err := a.Review("run_command", `{"cmd":"git commit -m x","permissions":"rw"}`); err != nil {
+		t.Fatalf("always-allow: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(root, ".agent", "approvals.json"))
+	if err != nil || !strings.Contains(string(b), `"run_command:git:writes"`) {
+		t.Fatalf("allowlist not persisted: %q err=%v", b, err)
+	}
+	fresh := newTestAgent(root)
+	fresh.Approve = true
+	fresh.Approver = &scriptedApprover{}
+	if _, err := fresh.Review("run_command", `{"cmd":"git commit -m y","permissions":"rw"}`); err != nil {
+		t.Fatalf("persisted allow: %v", err)
+	}
+
+	// the kind covers every program a command runs, not just the first
+	deny := &scriptedApprover{answers: []agent.Approval{{Reason: "no"}, {Reason: "no"}, {Reason: "no"}}}
+	fresh.Approver = deny
+	for _, cmd := range []string{"git status && rm -rf src", "FOO=1 rm -rf src", "./build.sh"} {
+		if _, err := fresh.Review("run_command", `{"cmd":"`+cmd+`","permissions":"rw"}`); err == nil {
+			t.Fatalf("%s: allowed without asking", cmd)
+		}
+	}
+	if got := []string{deny.seen[0].Kind, deny.seen[1].Kind, deny.seen[2].Kind}; got[0] != "run_command:git,rm:writes" || got[1] != "run_command:rm:writes" || got[2] != "" {
+		t.Fatalf("kinds: %q", got)
+	}
+}
+
+// TestApprovalDryRunNotPersisted keeps --dry-run "always allow" choices in memory.
+func TestApprovalDryRunNotPersisted(t *testing.T) {
+	root := t.TempDir()
+	a := newTestAgent(root)
+	a.Approve = true
+	a.Overlay = pkg.NewOverlayWorkspace(root, a.Ws)
+	a.Ws = a.Overlay
+	a.Approver = &scriptedApprover{answers: []agent.Approval{{Allow: true, Always: true, Persist: true}}}
+	for range 2 {
+		if _, err := a.Review("write_file", `{"path":"x.txt","content":"x"}`); err != nil {
+			t.Fatalf("review: %v", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, ".agent")); !os.IsNotExist(err) {
+		t.Fatalf("dry run wrote the allowlist: %v", err)
+	}
+}
+
+// TestApprovalKindWrappers keeps an always-allowed wrapper or trap from
+// covering a write it hides.
+func TestApprovalKindWrappers(t *testing.T) {
+	for _, c := range [][2]string{
+		{"trap 'touch a' EXIT", "trap 'rm -rf src' EXIT"},
+		{"setsid touch a", "setsid rm -rf src"},
+		{"flock /tmp/l touch a", "flock /tmp/l rm -rf src"},
+		{`env -S "touch a"`, `env -S "rm -rf src"`},
+	} {
+		a := newTestAgent(t.TempDir())
+		a.Approve = true
+		ap := &scriptedApprover{answers: []agent.Approval{{Allow: true, Always: true}, {Reason: "no"}}}
+		a.Approver = ap
+		if _, err := a.Review("run_command", `{"cmd":"`+strings.ReplaceAll(c[0], `"`, `\"`)+`","permissions":"rw"}`); err != nil {
+			t.Fatalf("%s: %v", c[0], err)
+		}
+		if _, err := a.Review("run_command", `{"cmd":"`+strings.ReplaceAll(c[1], `"`, `\"`)+`","permissions":"rw"}`); err == nil {
+			t.Fatalf("%s: allowed by the kind of %q (%s)", c[1], c[0], ap.seen[0].Kind)
+		}
+		if len(ap.seen) != 2 || !strings.Contains(ap.seen[1].Kind, "rm") {
+			t.Fatalf("%s: kinds %+v", c[1], ap.seen)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cds.agents.app/internal/services/agent"
+	"cds.agents.app/pkg"
+	"github.com/openai/openai-go/v2"
+	"github.com/openai/openai-go/v2/option"
+)
+
+// fakeCall is a tool call a fakeModel reply asks for.
+type fakeCall struct{ name, args string }
+
+// fakeModel serves chat completions from a script: each reply is a list of
+// tool calls, and an empty list (or running out of replies) ends the run
+// with a text answer. hook, when set, sees each request first (n from 1).
+type fakeModel struct {
+	replies [][]fakeCall
+	hook    func(n int, r *http.Request)
+
+	mu       sync.Mutex
+	requests int
+}
+
+// client starts the server and returns a client talking to it.
+func (m *fakeModel) client(t *testing.T) openai.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		m.requests++
+		n := m.requests
+		var reply []fakeCall
+		if len(m.replies) > 0 {
+			reply, m.replies = m.replies[0], m.replies[1:]
+		}
+		m.mu.Unlock()
+		if m.hook != nil {
+			m.hook(n, r)
+		}
+		msg := map[string]any{"role": "assistant", "content": "done"}
+		finish := "stop"
+		if len(reply) > 0 {
+			calls := make([]map[string]any, len(reply))
+			for i, c := range reply {
+				calls[i] = map[string]any{"id": fmt.Sprintf("call_%d", i), "type": "function", "function": map[string]string{"name": c.name, "arguments": c.args}}
+			}
+			msg = map[string]any{"role": "assistant", "content": "", "tool_calls": calls}
+			finish = "tool_calls"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"id": "chatcmpl-test", "object": "chat.completion", "model": "gpt-4o",
+			"choices": []map[string]any{{"index": 0, "message": msg, "finish_reason": finish}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return openai.NewClient(option.WithBaseURL(srv.URL), option.WithAPIKey("test"), option.WithMaxRetries(0))
+}
+
+// requestCount is how many completions were asked for.
+func (m *fakeModel) requestCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.requests
+}
+
+// TestAuditChain records tool calls in a hash-chained log and detects
+// modified, reordered and truncated logs.
+func TestAuditChain(t *testing.T) {
+	root := t.TempDir()
+	a := newTestAgent(root)
+	path := filepath.Join(root, "audit.jsonl")
+	l, err := pkg.CreateAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Audit = l
+	if err := l.Append("config", map[string]string{"model": a.Model}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := openai.ChatCompletionMessage{ToolCalls: []openai.ChatCompletionMessageToolCallUnion{
+		{ID: "c1", Type: "function", Function: openai.ChatCompletionMessageFunctionToolCallFunction{Name: "write_file", Arguments: `{"path":"a.txt","content":"hi"}`}},
+		{ID: "c2", Type: "function", Function: openai.ChatCompletionMessageFunctionToolCallFunction{Name: "read_file", Arguments: `{"path":"missing.txt"}`}},
+	}}
+	calls := pkg.ExtractToolCalls(msg)
+	phases, _ := a.PlanPhases(root, calls)
+	a.RunPhases(calls, phases, msg)
+	if err := l.Close(map[string]string{"status": "completed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	s, err := pkg.VerifyAudit(bytes.NewReader(data))
+	if err != nil || s.Records != 4 {
+		t.Fatalf("verify: %+v %v\n%s", s, err, data)
+	}
+	if !strings.Contains(string(data), `"arguments":"{\"path\":\"a.txt\",\"content\":\"hi\"}"`) || !strings.Contains(string(data), `"error":"`) {
+		t.Fatalf("tool calls not recorded:\n%s", data)
+	}
+
+	lines := strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n")
+	tampered := map[string]string{
+		"modified":  strings.Replace(string(data), `\"hi\"`, `\"ho\"`, 1),
+		"reordered": lines[0] + lines[2] + lines[1] + lines[3],
+		"removed":   lines[0] + lines[2] + lines[3],
+		"truncated": lines[0] + lines[1] + lines[2],
+		"appended":  string(data) + lines[1],
+	}
+	for name, text := range tampered {
+		if _, err := pkg.VerifyAudit(strings.NewReader(text)); err == nil {
+			t.Fatalf("%s log verified", name)
+		}
+	}
+
+	if _, err := pkg.CreateAuditLog(path); err == nil {
+		t.Fatalf("an existing audit log must not be reused")
+	}
+}
+
+// TestAuditLogProtected keeps the run's own audit log out of every tool's
+// reach, even under a policy that replaces paths.protect.
+func TestAuditLogProtected(t *testing.T) {
+	root := t.TempDir()
+	policy := pkg.DefaultPolicy()
+	policy.Paths.Protect = nil
+	logPath := filepath.Join(root, "logs", "audit.jsonl")
+	a := agent.NewAgent(pkg.Config{Model: "gpt-4o", Src: root, Concurrency: 2, Steps: 4, Timeout: time.Minute, Prompt: "tamper", AuditLog: logPath, Policy: policy})
+	model := &fakeModel{replies: [][]fakeCall{
+		{{"write_file", `{"path":"logs/audit.jsonl","content":"{}\n"}`}},
+		{{"run_command", `{"cmd":"rm -rf logs","permissions":"rw"}`}},
+		{{"delete_path", `{"path":"logs"}`}},
+	}}
+	a.Client = model.client(t)
+	if err := a.Run(); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pkg.VerifyAudit(bytes.NewReader(data)); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if n := strings.Count(string(data), "(paths.protect)"); n != 3 {
+		t.Fatalf("expected 3 paths.protect refusals, got %d:\n%s", n, data)
+	}
+	if len(policy.Paths.Protect) != 0 {
+		t.Fatalf("caller's policy was modified: %v", policy.Paths.Protect)
+	}
+}
@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cds.agents.app/pkg"
+	"github.com/openai/openai-go/v2"
+)
+
+// TestRunPhasesCancel kills a running command when the run is cancelled
+// and skips the calls that had not started.
+func TestRunPhasesCancel(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o644)
+	a := newTestAgent(root)
+	msg := openai.ChatCompletionMessage{ToolCalls: []openai.ChatCompletionMessageToolCallUnion{
+		{ID: "c1", Type: "function", Function: openai.ChatCompletionMessageFunctionToolCallFunction{Name: "run_command", Arguments: `{"cmd":"sleep 30","permissions":"r","writes":["b.txt"]}`}},
+		{ID: "c2", Type: "function", Function: openai.ChatCompletionMessageFunctionToolCallFunction{Name: "write_file", Arguments: `{"path":"b.txt","content":"b"}`}},
+	}}
+	calls := pkg.ExtractToolCalls(msg)
+	phases, _ := a.PlanPhases(root, calls)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(300*time.Millisecond, cancel)
+	start := time.Now()
+	a.RunPhasesContext(ctx, calls, phases, msg)
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("cancelled phase took %s", d)
+	}
+
+	n := len(a.Params.Messages)
+	cmd := a.Params.Messages[n-2].OfTool.Content.OfString.Value
+	if !strings.Contains(cmd, "(interrupted: the run was cancelled, process group killed)") || !strings.Contains(cmd, "\nERROR: <untrusted-data tool=\"run_command\"") || !strings.Contains(cmd, "\ncommand interrupted\n</untrusted-data nonce=") {
+		t.Fatalf("command result:\n%s", cmd)
+	}
+	if got := a.Params.Messages[n-1].OfTool.Content.OfString.Value; got != "skipped: the run was interrupted before this call started" {
+		t.Fatalf("write result: %s", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "b.txt")); err == nil {
+		t.Fatal("write ran after the run was cancelled")
+	}
+}
+
+// TestToolingCancelled refuses to start a call once the run is cancelled.
+func TestToolingCancelled(t *testing.T) {
+	root := t.TempDir()
+	a := newTestAgent(root)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := a.ToolingContext(ctx, root, "c", "write_file", `{"path":"x.txt","content":"x"}`); err == nil || !strings.Contains(err.Error(), "interrupted") {
+		t.Fatalf("expected interrupted error, got %v", err)
+	}
+	if ents, _ := os.ReadDir(root); len(ents) != 0 {
+		t.Fatalf("cancelled write left files: %v", ents)
+	}
+}
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cds.agents.app/pkg"
+)
+
+// TestDryRunOverlay ensures writes/deletes are staged and visible to reads without touching disk.
+func TestDryRunOverlay(t *testing.T) {
+	root := makeNested(t)
+	a := newTestAgent(root)
+	a.Overlay = pkg.NewOverlayWorkspace(root, a.Ws)
+	a.Ws = a.Overlay
+
+	if _, err := a.Tooling(root, "write_file", `{"path":"a/x.txt","content":"changed\n"}`); err != nil {
+		t.Fatalf("write_file err: %v", err)
+	}
+	if _, err := a.Tooling(root, "write_file", `{"path":"new/n.txt","content":"n\n"}`); err != nil {
+		t.Fatalf("write_file err: %v", err)
+	}
+	if _, err := a.Tooling(root, "delete_path", `{"path":"a/b"}`); err != nil {
+		t.Fatalf("delete_path err: %v", err)
+	}
+
+	out, err := a.Tooling(root, "read_file", `{"path":"a/x.txt"}`)
+	if err != nil || out != "changed\n" {
+		t.Fatalf("expected staged content, got %q err=%v", out, err)
+	}
+	if _, err := a.Tooling(root, "read_file", `{"path":"a/b/y.txt"}`); err == nil {
+		t.Fatalf("expected deleted file to be hidden")
+	}
+	out, err = a.Tooling(root, "list_dir_recursive", `{"dir":"."}`)
+	if err != nil {
+		t.Fatalf("list_dir_recursive err: %v", err)
+	}
+	if strings.Contains(out, "a/b") || !strings.Contains(out, "FILE new/n.txt") {
+		t.Fatalf("unexpected merged listing:\n%s", out)
+	}
+
+	// disk untouched
+	if b, _ := os.ReadFile(filepath.Join(root, "a", "x.txt")); string(b) != "x" {
+		t.Fatalf("disk modified: %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a", "b", "y.txt")); err != nil {
+		t.Fatalf("disk delete happened: %v", err)
+	}
+
+	patch := a.Overlay.Patch()
+	for _, want := range []string{"--- a/a/x.txt", "+changed", "--- /dev/null\n+++ b/new/n.txt", "--- a/a/b/c/z.txt\n+++ /dev/null"} {
+		if !strings.Contains(patch, want) {
+			t.Fatalf("patch missing %q:\n%s", want, patch)
+		}
+	}
+}
+
+// TestDryRunWriteConflicts refuses staged writes that would fail on disk:
+// over a directory or below a file, whether in the base or staged.
+func TestDryRunWriteConflicts(t *testing.T) {
+	root := makeNested(t)
+	a := newTestAgent(root)
+	a.Overlay = pkg.NewOverlayWorkspace(root, a.Ws)
+	a.Ws = a.Overlay
+
+	if _, err := a.Tooling(root, "write_file", `{"path":"new.txt","content":"n"}`); err != nil {
+		t.Fatalf("write_file err: %v", err)
+	}
+	for path, want := range map[string]string{
+		"a/b":           "is a directory",
+		"a/x.txt/y.txt": "not a directory",
+		"new.txt/y.txt": "not a directory",
+	} {
+		if _, err := a.Tooling(root, "write_file", `{"path":"`+path+`","content":"y"}`); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected %q, got %v", path, want, err)
+		}
+	}
+	// a deleted directory can be replaced by a file
+	if _, err := a.Tooling(root, "delete_path", `{"path":"a/b"}`); err != nil {
+		t.Fatalf("delete_path err: %v", err)
+	}
+	if _, err := a.Tooling(root, "write_file", `{"path":"a/b","content":"f"}`); err != nil {
+		t.Fatalf("write over deleted dir: %v", err)
+	}
+}
+
+// TestDryRunCommandReadOnly ensures run_command refuses writes in dry-run mode.
+func TestDryRunCommandReadOnly(t *testing.T) {
+	root := t.TempDir()
+	a := newTestAgent(root)
+	a.Overlay = pkg.NewOverlayWorkspace(root, a.Ws)
+	a.Ws = a.Overlay
+	if _, err := a.Tooling(root, "run_command", `{"cmd":"echo hi > f.txt","permissions":"rw"}`); err == nil {
+		t.Fatalf("expected dry-run to refuse a writing command")
+	}
+}
@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cds.agents.app/internal/services/agent"
+	"cds.agents.app/pkg"
+)
+
+// TestGitHelpers covers dirty detection, branch naming, staging and commit,
+// leaving pre-existing changes uncommitted and running the repo's hooks.
+func TestGitHelpers(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := t.TempDir()
+	g := pkg.Git{Dir: root}
+	if out, err := exec.Command("git", "-C", root, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v %s", err, out)
+	}
+	if !g.IsRepo() {
+		t.Fatalf("expected a repo")
+	}
+	if dirty, err := g.Dirty(); err != nil || dirty {
+		t.Fatalf("fresh repo dirty=%v err=%v", dirty, err)
+	}
+
+	// agent bookkeeping is ignored
+	_ = os.MkdirAll(filepath.Join(root, ".agent", "runs"), 0o755)
+	_ = os.WriteFile(filepath.Join(root, ".agent", "runs", "log"), []byte("x"), 0o644)
+	_ = os.WriteFile(filepath.Join(root, pkg.ApprovalsFile), []byte("{}"), 0o644)
+	if dirty, _ := g.Dirty(); dirty {
+		t.Fatalf("run outputs should not make the tree dirty")
+	}
+
+	branch := pkg.BranchName("Fix the README typos!", time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+	if branch != "agent/fix-the-readme-typos-20250102-030405" {
+		t.Fatalf("unexpected branch %q", branch)
+	}
+	if err := g.CreateBranch(branch); err != nil {
+		t.Fatalf("branch: %v", err)
+	}
+	_ = os.WriteFile(filepath.Join(root, "a.txt"), []byte("a\n"), 0o644)
+	diff, err := g.StageAll()
+	if err != nil || !strings.Contains(diff, "+a") {
+		t.Fatalf("stage: %q err=%v", diff, err)
+	}
+	if err := g.Commit("Add a.txt\n\nAgent-Model: gpt-4o\n"); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	out, _ := exec.Command("git", "-C", root, "log", "-1", "--format=%s|%(trailers:key=Agent-Model,valueonly)").Output()
+	if !strings.HasPrefix(string(out), "Add a.txt|gpt-4o") {
+		t.Fatalf("unexpected commit: %q", out)
+	}
+	if out, _ := exec.Command("git", "-C", root, "ls-files").Output(); strings.Contains(string(out), ".agent") {
+		t.Fatalf("run outputs committed: %s", out)
+	}
+
+	// changes that predate the run stay out of its commit, staged or not
+	_ = os.WriteFile(filepath.Join(root, "a.txt"), []byte("user\n"), 0o644)
+	_ = os.WriteFile(filepath.Join(root, "staged.txt"), []byte("user\n"), 0o644)
+	if out, err := exec.Command("git", "-C", root, "add", "staged.txt").CombinedOutput(); err != nil {
+		t.Fatalf("git add: %v %s", err, out)
+	}
+	skip, err := g.DirtyPaths()
+	if err != nil || strings.Join(skip, ",") != "a.txt,staged.txt" {
+		t.Fatalf("dirty paths %q err=%v", skip, err)
+	}
+	_ = os.WriteFile(filepath.Join(root, "b.txt"), []byte("b\n"), 0o644)
+	diff, err = g.StageAll(skip...)
+	if err != nil || !strings.Contains(diff, "+b") || strings.Contains(diff, "user") {
+		t.Fatalf("stage with skip: %q err=%v", diff, err)
+	}
+	if err := g.Commit("Add b.txt\n", skip...); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	out, _ = exec.Command("git", "-C", root, "show", "--name-only", "--format=", "HEAD").Output()
+	if strings.TrimSpace(string(out)) != "b.txt" {
+		t.Fatalf("commit touched %q, want only b.txt", out)
+	}
+	out, _ = exec.Command("git", "-C", root, "status", "--porcelain").Output()
+	if !strings.Contains(string(out), " M a.txt") || !strings.Contains(string(out), "A  staged.txt") {
+		t.Fatalf("user changes not left as they were: %q", out)
+	}
+
+	// the repository's hooks run
+	hook := filepath.Join(root, ".git", "hooks", "pre-commit")
+	_ = os.WriteFile(hook, []byte("#!/bin/sh\necho blocked by hook >&2\nexit 1\n"), 0o755)
+	_ = os.WriteFile(filepath.Join(root, "c.txt"), []byte("c\n"), 0o644)
+	if _, err := g.StageAll(skip...); err != nil {
+		t.Fatalf("stage: %v", err)
+	}
+	if err := g.Commit("Add c.txt\n", skip...); err == nil || !strings.Contains(err.Error(), "blocked by hook") {
+		t.Fatalf("expected the pre-commit hook to refuse, got %v", err)
+	}
+}
+
+// TestGitCommitInterrupted commits an interrupted run with the fallback
+// message instead of asking the model after Ctrl-C.
+func TestGitCommitInterrupted(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := t.TempDir()
+	if out, err := exec.Command("git", "-C", root, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v %s", err, out)
+	}
+	a := agent.NewAgent(pkg.Config{Model: "gpt-4o", Src: root, Concurrency: 2, Steps: 4, Timeout: time.Minute, Prompt: "Add a.txt", GitCommit: true, AuditLog: "none"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	model := &fakeModel{
+		replies: [][]fakeCall{{{"write_file", `{"path":"a.txt","content":"a\n"}`}}},
+		// Ctrl-C while the second turn waits on the model
+		hook: func(n int, r *http.Request) {
+			if n == 2 {
+				cancel()
+				select {
+				case <-r.Context().Done():
+				case <-time.After(2 * time.Second):
+				}
+			}
+		},
+	}
+	a.Client = model.client(t)
+	if err := a.RunContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected an interrupted run, got %v", err)
+	}
+	if n := model.requestCount(); n != 2 {
+		t.Fatalf("model asked %d times, want 2 (no commit message after Ctrl-C)", n)
+	}
+	out, _ := exec.Command("git", "-C", root, "log", "-1", "--format=%s").Output()
+	if strings.TrimSpace(string(out)) != "agent: Add a.txt" {
+		t.Fatalf("commit subject %q", out)
+	}
+}
@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"cds.agents.app/pkg"
+)
+
+// TestRunCommandLimits applies rlimits, caps streamed output, reports the
+// limit that stopped a command and kills its whole process group on timeout.
+func TestRunCommandLimits(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process limits are applied by the Linux helper")
+	}
+	root := t.TempDir()
+	a := newTestAgent(root)
+	a.Policy = pkg.DefaultPolicy()
+	a.Policy.Limits.CPUTime = time.Second
+	a.Policy.Limits.MaxOpenFiles = 64
+	a.Policy.Limits.MaxOutputBytes = 2000
+	a.Policy.Limits.DefaultTimeout = 2 * time.Second
+
+	out, err := a.Tooling(root, "run_command", `{"cmd":"echo nofile=$(ulimit -n) cpu=$(ulimit -t)","permissions":"r"}`)
+	if err != nil || !strings.Contains(out, "nofile=64 cpu=1") {
+		t.Fatalf("rlimits not applied: %q err=%v", out, err)
+	}
+
+	out, err = a.Tooling(root, "run_command", `{"cmd":"head -c 50000000 /dev/zero | tr '\\0' a","permissions":"r"}`)
+	if err != nil || len(out) > 2400 || !strings.Contains(out, "output_bytes=500") || !strings.Contains(out, "output limit of 2000 bytes hit") {
+		t.Fatalf("output cap: %d bytes %q err=%v", len(out), out[max(0, len(out)-120):], err)
+	}
+
+	out, err = a.Tooling(root, "run_command", `{"cmd":"while :; do :; done","permissions":"r","timeout":"10s"}`)
+	if err == nil || !strings.Contains(out, "limit hit: cpu_time") {
+		t.Fatalf("cpu limit: %q err=%v", out, err)
+	}
+
+	start := time.Now()
+	out, err = a.Tooling(root, "run_command", `{"cmd":"sleep 60 & echo $! > bg.pid; wait","permissions":"rw"}`)
+	if err == nil || !strings.Contains(out, "process group killed") || time.Since(start) > 8*time.Second {
+		t.Fatalf("timeout: %q err=%v after %s", out, err, time.Since(start))
+	}
+	raw, _ := os.ReadFile(filepath.Join(root, "bg.pid"))
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(raw)))
+	if pid <= 0 {
+		t.Fatalf("background pid not recorded: %q", raw)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if processAlive(pid) {
+		if p, err := os.FindProcess(pid); err == nil {
+			p.Kill()
+		}
+		t.Fatalf("background process %d survived the timeout", pid)
+	}
+}
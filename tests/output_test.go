@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"cds.agents.app/pkg"
+)
+
+// TestRunCommandSpill keeps head and tail of long output in the result and
+// saves the complete stdout and stderr to a log the model can read.
+func TestRunCommandSpill(t *testing.T) {
+	root := t.TempDir()
+	a := newTestAgent(root)
+	a.Policy = pkg.DefaultPolicy()
+	a.Policy.Limits.MaxOutputBytes = 2000
+
+	cmd := `for i in $(seq 1 2000); do echo line-$i; done; sleep 0.2; echo FAIL: TestImportant >&2; exit 1`
+	out, err := a.ToolingCall(root, "call_Ab/9", "run_command", `{"cmd":"`+cmd+`","permissions":"r"}`)
+	if err == nil {
+		t.Fatalf("expected the exit status as error")
+	}
+	header, body, _ := strings.Cut(out, "\n")
+	m := regexp.MustCompile(`^exit_code=1 duration=\S+ output_bytes=\d+ log=(\S+)$`).FindStringSubmatch(header)
+	if m == nil {
+		t.Fatalf("header: %q", header)
+	}
+	if want := ".agent/runs/" + a.RunID + "/outputs/call_Ab_9.log"; m[1] != want {
+		t.Fatalf("log path %q, want %q", m[1], want)
+	}
+	if !strings.Contains(body, "FAIL: TestImportant") || !strings.Contains(body, "bytes omitted") || len(body) > 2300 {
+		t.Fatalf("body should keep head and tail within the budget:\n%s", body)
+	}
+
+	log, err := a.Tooling(root, "read_file", `{"path":"`+m[1]+`"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, ok := strings.Cut(log, "==> stderr <==\n")
+	if !ok || !strings.Contains(stdout, "line-1\n") || !strings.Contains(stdout, "line-2000\n") || strings.Contains(stdout, "FAIL:") || !strings.Contains(stderr, "FAIL: TestImportant") {
+		t.Fatalf("log should hold stdout and stderr separately:\n%.300s", log)
+	}
+
+	// short output is returned whole and not spilled
+	out, err = a.Tooling(root, "run_command", `{"cmd":"echo short","permissions":"r"}`)
+	if err != nil || !strings.HasPrefix(out, "exit_code=0 ") || strings.Contains(out, "log=") || !strings.Contains(out, "short\n") {
+		t.Fatalf("short output: %q err=%v", out, err)
+	}
+	if ents, _ := os.ReadDir(filepath.Join(root, ".agent", "runs", a.RunID, "outputs")); len(ents) != 1 {
+		t.Fatalf("expected one spilled log, got %d", len(ents))
+	}
+}
@@ -0,0 +1,235 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cds.agents.app/internal/services/agent"
+	"cds.agents.app/pkg"
+	"github.com/openai/openai-go/v2"
+)
+
+// TestPlanPhasesHierarchy orders calls on nested paths as emitted and runs
+// unrelated calls together.
+func TestPlanPhasesHierarchy(t *testing.T) {
+	root := t.TempDir()
+	a := newTestAgent(root)
+	cases := []struct {
+		name  string
+		calls [][2]string
+		want  string
+	}{
+		{"delete dir before reading inside it", [][2]string{{"delete_path", `{"path":"a/b"}`}, {"read_file", `{"path":"a/b/c/z.txt"}`}}, "[[0] [1]]"},
+		{"read inside dir before deleting it", [][2]string{{"read_file", `{"path":"a/b/c/z.txt"}`}, {"delete_path", `{"path":"a/b"}`}}, "[[0] [1]]"},
+		{"recursive listing sees writes below it", [][2]string{{"list_dir_recursive", `{"dir":"a"}`}, {"write_file", `{"path":"a/b/new.txt"}`}, {"list_dir_recursive", `{"dir":"a"}`}}, "[[0] [1] [2]]"},
+		{"write creating parents before listing an ancestor", [][2]string{{"write_file", `{"path":"x/y/z.txt"}`}, {"list_dir", `{"dir":"x"}`}, {"list_dir", `{"dir":"."}`}}, "[[0] [1 2]]"},
+		{"read before write keeps emitted order", [][2]string{{"read_file", `{"path":"f.txt"}`}, {"write_file", `{"path":"f.txt"}`}, {"read_file", `{"path":"f.txt"}`}}, "[[0] [1] [2]]"},
+		{"reads and listings run together", [][2]string{{"read_file", `{"path":"a/x.txt"}`}, {"list_dir", `{"dir":"a"}`}, {"list_dir_recursive", `{"dir":"."}`}}, "[[0 1 2]]"},
+		{"unrelated paths run together", [][2]string{{"write_file", `{"path":"a/x.txt"}`}, {"delete_path", `{"path":"b"}`}, {"read_file", `{"path":"ab/x.txt"}`}}, "[[0 1 2]]"},
+	}
+	for _, c := range cases {
+		calls := make([]pkg.ToolCallLite, len(c.calls))
+		for i, tc := range c.calls {
+			calls[i] = pkg.ToolCallLite{FuncName: tc[0], FuncArgs: tc[1]}
+		}
+		phases, err := a.PlanPhases(root, calls)
+		if got := fmt.Sprint(phases); err != nil || got != c.want {
+			t.Fatalf("%s: got %s want %s (err=%v)", c.name, got, c.want, err)
+		}
+	}
+}
+
+// TestPlanPhasesCommandEffects orders run_command by its declared or
+// inferred paths and isolates commands whose effects are unknown.
+func TestPlanPhasesCommandEffects(t *testing.T) {
+	root := t.TempDir()
+	a := newTestAgent(root)
+	cases := []struct {
+		name  string
+		calls [][2]string
+		want  string
+	}{
+		{"edit before tests of the same package", [][2]string{{"write_file", `{"path":"pkg/a.go"}`}, {"run_command", `{"cmd":"go test ./pkg/..."}`}}, "[[0] [1]]"},
+		{"tests of another package run alongside", [][2]string{{"write_file", `{"path":"pkg/a.go"}`}, {"run_command", `{"cmd":"go test ./cmd/..."}`}}, "[[0 1]]"},
+		{"cat runs alongside an unrelated write", [][2]string{{"run_command", `{"cmd":"cat a.txt | wc -l"}`}, {"write_file", `{"path":"b.txt"}`}}, "[[0 1]]"},
+		{"redirect target orders a later read", [][2]string{{"run_command", `{"cmd":"echo hi > out.txt"}`}, {"read_file", `{"path":"out.txt"}`}}, "[[0] [1]]"},
+		{"unknown program is a barrier", [][2]string{{"read_file", `{"path":"a.txt"}`}, {"run_command", `{"cmd":"python3 tool.py"}`}, {"read_file", `{"path":"b.txt"}`}}, "[[0] [1] [2]]"},
+		{"declared effects override inference", [][2]string{{"run_command", `{"cmd":"make gen","writes":["gen"]}`}, {"write_file", `{"path":"src/x.go"}`}, {"read_file", `{"path":"gen/out.go"}`}}, "[[0 1] [2]]"},
+		{"start_process is a barrier", [][2]string{{"read_file", `{"path":"a.txt"}`}, {"start_process", `{"cmd":"cat a.txt"}`}}, "[[0] [1]]"},
+	}
+	for _, c := range cases {
+		calls := make([]pkg.ToolCallLite, len(c.calls))
+		for i, tc := range c.calls {
+			calls[i] = pkg.ToolCallLite{FuncName: tc[0], FuncArgs: tc[1]}
+		}
+		phases, err := a.PlanPhases(root, calls)
+		if got := fmt.Sprint(phases); err != nil || got != c.want {
+			t.Fatalf("%s: got %s want %s (err=%v)", c.name, got, c.want, err)
+		}
+	}
+}
+
+// TestPlanPhasesSymlinkAlias orders calls that reach the same file through
+// an in-tree symlink, and a write through the link lands in its target.
+func TestPlanPhasesSymlinkAlias(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "real"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("real", filepath.Join(root, "alias")); err != nil {
+		t.Fatal(err)
+	}
+	a := newTestAgent(root)
+	cases := []struct {
+		name  string
+		calls [][2]string
+		want  string
+	}{
+		{"write through the link before reading the target", [][2]string{{"write_file", `{"path":"alias/f.txt"}`}, {"read_file", `{"path":"real/f.txt"}`}}, "[[0] [1]]"},
+		{"listing the link sees writes in the target", [][2]string{{"list_dir", `{"dir":"alias"}`}, {"write_file", `{"path":"real/g.txt"}`}}, "[[0] [1]]"},
+		{"deleting the link leaves the target alone", [][2]string{{"delete_path", `{"path":"alias"}`}, {"read_file", `{"path":"real/f.txt"}`}}, "[[0 1]]"},
+	}
+	for _, c := range cases {
+		calls := make([]pkg.ToolCallLite, len(c.calls))
+		for i, tc := range c.calls {
+			calls[i] = pkg.ToolCallLite{FuncName: tc[0], FuncArgs: tc[1]}
+		}
+		phases, err := a.PlanPhases(root, calls)
+		if got := fmt.Sprint(phases); err != nil || got != c.want {
+			t.Fatalf("%s: got %s want %s (err=%v)", c.name, got, c.want, err)
+		}
+	}
+
+	if _, err := a.Tooling(root, "write_file", `{"path":"alias/f.txt","content":"hi"}`); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(root, "real", "f.txt")); err != nil || string(b) != "hi" {
+		t.Fatalf("write through link: %q, %v", b, err)
+	}
+}
+
+// TestRunCommandDeclaredWrites refuses a command writing outside what it
+// declared, since the planner relied on the declaration.
+func TestRunCommandDeclaredWrites(t *testing.T) {
+	root := t.TempDir()
+	a := newTestAgent(root)
+	if _, err := a.Tooling(root, "run_command", `{"cmd":"touch x.txt","writes":[]}`); err == nil || !strings.Contains(err.Error(), "declared writes") {
+		t.Fatalf("expected declared-writes refusal, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "x.txt")); err == nil {
+		t.Fatal("refused command ran")
+	}
+	if _, err := a.Tooling(root, "run_command", `{"cmd":"touch out/x.txt","writes":["out"]}`); err != nil && strings.Contains(err.Error(), "declared writes") {
+		t.Fatalf("covered write refused: %v", err)
+	}
+}
+
+// TestPlanReasons explains every edge and renders the plan as DOT and
+// Mermaid from calls in the audit-log shape.
+func TestPlanReasons(t *testing.T) {
+	calls, err := pkg.ParsePlanCalls([]byte(`[
+		{"name":"write_file","arguments":{"path":"a/b.txt"}},
+		{"name":"run_command","arguments":"{\"cmd\":\"cat a/b.txt\"}"},
+		{"name":"python_tool","arguments":null},
+		{"name":"run_command","arguments":{"cmd":"./build.sh"}},
+		{"name":"read_process_output","arguments":{"id":"p1"}},
+		{"name":"stop_process","arguments":{"id":"p1"}}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newTestAgent(t.TempDir()).Plan(".", calls)
+	text := p.Text()
+	for _, want := range []string{
+		"phase 1: #0 write_file a/b.txt, #2 python_tool\n",
+		"phase 2: #1 run_command cat a/b.txt\n",
+		"#0 -> #1: paths nest: a/b.txt (write) and a/b.txt (read)\n",
+		"#2 -> #3: barrier: run_command with undeclared effects\n",
+		"#3 -> #4: barrier: run_command with undeclared effects\n",
+		"#4 -> #5: same process p1\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("plan text missing %q:\n%s", want, text)
+		}
+	}
+	dot := pkg.RenderPlans("dot", []pkg.Plan{p})
+	if !strings.HasPrefix(dot, "digraph plan {") || !strings.Contains(dot, `t1_c0 -> t1_c1 [label="paths nest: a/b.txt (write) and a/b.txt (read)"];`) {
+		t.Fatalf("dot:\n%s", dot)
+	}
+	mmd := pkg.RenderPlans("mermaid", []pkg.Plan{p})
+	if !strings.HasPrefix(mmd, "flowchart TD\n") || !strings.Contains(mmd, `t1_c4 -->|"same process p1"| t1_c5`) {
+		t.Fatalf("mermaid:\n%s", mmd)
+	}
+	if _, err := pkg.PlanGraphFormat("plan.svg"); err == nil {
+		t.Fatal("plan.svg accepted as a graph format")
+	}
+}
+
+// TestRunPhasesSkipsDependents skips calls downstream of a failed write,
+// runs unrelated ones, and aborts the turn with StopOnError.
+func TestRunPhasesSkipsDependents(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "f.txt"), []byte("file, not a directory\n"), 0o644)
+	os.WriteFile(filepath.Join(root, "c.txt"), []byte("c\n"), 0o644)
+	run := func(a *agent.Agent, calls [][2]string) []string {
+		msg := openai.ChatCompletionMessage{}
+		for i, c := range calls {
+			msg.ToolCalls = append(msg.ToolCalls, openai.ChatCompletionMessageToolCallUnion{
+				ID: fmt.Sprintf("call_%d", i), Type: "function",
+				Function: openai.ChatCompletionMessageFunctionToolCallFunction{Name: c[0], Arguments: c[1]},
+			})
+		}
+		lite := pkg.ExtractToolCalls(msg)
+		phases, _ := a.PlanPhases(root, lite)
+		a.RunPhases(lite, phases, msg)
+		out := make([]string, len(calls))
+		for i, m := range a.Params.Messages[len(a.Params.Messages)-len(calls):] {
+			out[i] = m.OfTool.Content.OfString.Value
+		}
+		return out
+	}
+
+	out := run(newTestAgent(root), [][2]string{
+		{"write_file", `{"path":"f.txt/a.txt","content":"x"}`},
+		{"read_file", `{"path":"f.txt/a.txt"}`},
+		{"list_dir", `{"dir":"f.txt"}`},
+		{"read_file", `{"path":"c.txt"}`},
+	})
+	if !strings.HasPrefix(out[0], "ERROR: ") {
+		t.Fatalf("write into a file succeeded: %s", out[0])
+	}
+	for _, i := range []int{1, 2} {
+		if out[i] != "skipped: depends on failed call call_0 (write_file f.txt/a.txt)" {
+			t.Fatalf("call %d: %s", i, out[i])
+		}
+	}
+	if !strings.Contains(out[3], "\nc\n") {
+		t.Fatalf("unrelated read did not run: %s", out[3])
+	}
+
+	// a failed read changes nothing, so the write after it still runs
+	out = run(newTestAgent(root), [][2]string{
+		{"read_file", `{"path":"new.txt"}`},
+		{"write_file", `{"path":"new.txt","content":"n"}`},
+	})
+	if !strings.HasPrefix(out[0], "ERROR: ") || strings.HasPrefix(out[1], "skipped") {
+		t.Fatalf("write after failed read: %q", out)
+	}
+
+	a := newTestAgent(root)
+	a.StopOnError = true
+	out = run(a, [][2]string{
+		{"read_file", `{"path":"missing.txt"}`},
+		{"write_file", `{"path":"missing.txt","content":"m"}`},
+		{"read_file", `{"path":"c.txt"}`},
+	})
+	if out[1] != "skipped: turn aborted after call call_0 (read_file missing.txt) failed" || !strings.Contains(out[2], "\nc\n") {
+		t.Fatalf("abort: %q", out)
+	}
+	if _, err := os.Stat(filepath.Join(root, "missing.txt")); err == nil {
+		t.Fatal("aborted write ran")
+	}
+}
@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cds.agents.app/pkg"
+)
+
+// TestMatchGlob covers segment-local and recursive wildcards.
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"**", "a/b/c.go", true},
+		{"**", ".", true},
+		{"*.md", "README.md", true},
+		{"*.md", "docs/a.md", false},
+		{"**/*.md", "docs/a.md", true},
+		{"**/*.md", "README.md", true},
+		{"docs/**", "docs", true},
+		{"docs/**", "docs/x/y", true},
+		{"docs/**", "docsx/y", false},
+		{".github/workflows/**", ".github/workflows/ci.yml", true},
+		{"internal/*/x.go", "internal/a/b/x.go", false},
+		{"go.su?", "go.sum", true},
+	}
+	for _, c := range cases {
+		if got := pkg.MatchGlob(c.pattern, c.name); got != c.want {
+			t.Errorf("MatchGlob(%q, %q) = %v, want %v", c.pattern, c.name, got, c.want)
+		}
+	}
+}
+
+// TestPolicyCheck loads a policy file and evaluates calls against it.
+func TestPolicyCheck(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, ".agent"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	yml := `tools:
+  deny: [delete_path]
+paths:
+  write: ["internal/**", "docs/**"]
+  deny: [".git/**"]
+commands:
+  allow:
+    - go
+    - program: git
+      args: ["status*", "diff*"]
+limits:
+  max_timeout: 2m
+  max_output_bytes: 100
+`
+	if err := os.WriteFile(filepath.Join(root, pkg.PolicyFile), []byte(yml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, path, err := pkg.ResolvePolicy(root, "")
+	if err != nil || path == "" {
+		t.Fatalf("resolve: path=%q err=%v", path, err)
+	}
+
+	cases := []struct {
+		tool string
+		args map[string]any
+		rule string // "" = allowed
+	}{
+		{"read_file", map[string]any{"path": "go.mod"}, ""},
+		{"read_file", map[string]any{"path": ".git/config"}, "paths.deny"},
+		{"write_file", map[string]any{"path": "internal/a.go"}, ""},
+		{"write_file", map[string]any{"path": "/internal/a.go"}, ""},
+		{"write_file", map[string]any{"path": "go.sum"}, "paths.write"},
+		{"delete_path", map[string]any{"path": "internal"}, "tools.deny"},
+		{"run_command", map[string]any{"cmd": "git status -s && go test ./..."}, ""},
+		{"run_command", map[string]any{"cmd": "git push origin main"}, "commands.allow"},
+		{"run_command", map[string]any{"cmd": "ls"}, "commands.allow"},
+		{"run_command", map[string]any{"cmd": "go vet > report.txt"}, "paths.write"},
+		{"run_command", map[string]any{"cmd": "go vet < .git/config"}, "paths.deny"},
+		{"run_command", map[string]any{"cmd": "go test ./.git/..."}, "paths.deny"},
+		{"run_command", map[string]any{"cmd": "go vet < " + filepath.Join(root, ".git/config")}, "paths.deny"},
+		{"run_command", map[string]any{"cmd": "go test", "timeout": "10m"}, "limits.max_timeout"},
+	}
+	for _, c := range cases {
+		err := p.Check(root, c.tool, c.args)
+		var perr *pkg.PolicyError
+		switch {
+		case c.rule == "" && err != nil:
+			t.Errorf("%s %v: unexpected denial: %v", c.tool, c.args, err)
+		case c.rule != "" && !errors.As(err, &perr):
+			t.Errorf("%s %v: expected %s denial, got %v", c.tool, c.args, c.rule, err)
+		case c.rule != "" && perr.Rule != c.rule:
+			t.Errorf("%s %v: rule=%s want %s (%v)", c.tool, c.args, perr.Rule, c.rule, err)
+		}
+	}
+
+	// omitted keys keep their defaults
+	if p.Timeout("") != time.Minute || p.Timeout("10m") != 2*time.Minute || p.OutputLimit() != 100 {
+		t.Fatalf("limits: default=%s capped=%s output=%d", p.Timeout(""), p.Timeout("10m"), p.OutputLimit())
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "bad.yaml"), []byte("tool: {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := pkg.ResolvePolicy(root, filepath.Join(root, "bad.yaml")); err == nil {
+		t.Fatalf("expected unknown key to be rejected")
+	}
+}
+
+// TestPolicyDenyWrappers applies the default commands.deny list to programs
+// run through wrappers and deferred actions.
+func TestPolicyDenyWrappers(t *testing.T) {
+	root := t.TempDir()
+	p := pkg.DefaultPolicy()
+	for _, cmd := range []string{
+		"curl http://x",
+		"setsid curl http://x",
+		"exec -a x curl http://x",
+		`env -S "curl http://x"`,
+		`trap "curl http://x" EXIT`,
+		"flock /tmp/l wget http://x",
+		"flock /tmp/l -c 'wget http://x'",
+		"watch -n 1 curl http://x",
+		"busybox wget http://x",
+	} {
+		err := p.Check(root, "run_command", map[string]any{"cmd": cmd})
+		var perr *pkg.PolicyError
+		if !errors.As(err, &perr) || perr.Rule != "commands.deny" {
+			t.Errorf("%q: expected commands.deny, got %v", cmd, err)
+		}
+	}
+}
+
+// TestPolicyTooling ensures denials reach the model and limits apply to commands.
+func TestPolicyTooling(t *testing.T) {
+	root := t.TempDir()
+	a := newTestAgent(root)
+	a.Policy = pkg.DefaultPolicy()
+	a.Policy.Paths.Write = []string{"docs/**"}
+	a.Policy.Limits.MaxOutputBytes = 10
+
+	if _, err := a.Tooling(root, "write_file", `{"path":"main.go","content":"x"}`); err == nil || !strings.Contains(err.Error(), "paths.write") {
+		t.Fatalf("expected paths.write denial, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "main.go")); !os.IsNotExist(err) {
+		t.Fatalf("denied write reached disk: %v", err)
+	}
+	if _, err := a.Tooling(root, "write_file", `{"path":"docs/a.md","content":"x"}`); err != nil {
+		t.Fatalf("allowed write: %v", err)
+	}
+	if _, err := a.Review("write_file", `{"path":"main.go","content":"x"}`); err == nil {
+		t.Fatalf("expected Review to apply the policy without --approve")
+	}
+	out, err := a.Tooling(root, "run_command", `{"cmd":"echo 0123456789abcdef","permissions":"r"}`)
+	_, body, _ := strings.Cut(out, "\n")
+	head, rest, _ := strings.Cut(body, "\n...[")
+	_, tail, _ := strings.Cut(rest, "]...\n")
+	if err != nil || !strings.Contains(rest, "output limit of 10 bytes hit") || len(head)+len(tail) > 10 {
+		t.Fatalf("output limit: %q err=%v", out, err)
+	}
+}
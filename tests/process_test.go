@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"cds.agents.app/pkg"
+)
+
+var nextCursor = regexp.MustCompile(`next_cursor=(\d+)`)
+
+// TestBackgroundProcess starts a process, feeds it input, reads its output
+// incrementally and stops it together with its children.
+func TestBackgroundProcess(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process groups are managed by the Linux helper")
+	}
+	root := t.TempDir()
+	a := newTestAgent(root)
+	defer a.Procs.StopAll()
+
+	out, err := a.Tooling(root, "start_process", `{"cmd":"echo ready; sleep 300 & echo child=$!; while read line; do echo got:$line; done","permissions":"r"}`)
+	if err != nil || !strings.HasPrefix(out, "id=p1 status=running") || !strings.Contains(out, "ready") {
+		t.Fatalf("start: %q err=%v", out, err)
+	}
+	child, _ := strconv.Atoi(regexp.MustCompile(`child=(\d+)`).FindStringSubmatch(out)[1])
+	cursor := nextCursor.FindStringSubmatch(out)[1]
+
+	if _, err := a.Tooling(root, "write_process_stdin", `{"id":"p1","input":"hello\n"}`); err != nil {
+		t.Fatalf("stdin: %v", err)
+	}
+	out, err = a.Tooling(root, "read_process_output", `{"id":"p1","cursor":`+cursor+`,"wait":"5s"}`)
+	if err != nil || !strings.Contains(out, "got:hello") || strings.Contains(out, "ready") {
+		t.Fatalf("incremental read: %q err=%v", out, err)
+	}
+
+	out, err = a.Tooling(root, "stop_process", `{"id":"p1"}`)
+	if err != nil || !strings.Contains(out, "stopped p1: exited") {
+		t.Fatalf("stop: %q err=%v", out, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if processAlive(child) {
+		if p, err := os.FindProcess(child); err == nil {
+			p.Kill()
+		}
+		t.Fatalf("child %d survived stop_process", child)
+	}
+	if _, err := a.Tooling(root, "write_process_stdin", `{"id":"p1","input":"x"}`); err == nil {
+		t.Fatalf("stdin to a stopped process should fail")
+	}
+	if _, err := a.Tooling(root, "read_process_output", `{"id":"p9"}`); err == nil {
+		t.Fatalf("unknown id should fail")
+	}
+
+	// a command that exits on its own reports its status
+	out, _ = a.Tooling(root, "start_process", `{"cmd":"echo bye; exit 3","permissions":"r"}`)
+	if !strings.Contains(out, "status=exited (code 3)") {
+		t.Fatalf("exit status: %q", out)
+	}
+
+	// StopAll (deferred by Run) leaves nothing behind
+	out, _ = a.Tooling(root, "start_process", `{"cmd":"sleep 300","permissions":"r"}`)
+	if !strings.Contains(out, "status=running") {
+		t.Fatalf("start sleep: %q", out)
+	}
+	a.Procs.StopAll()
+	out, _ = a.Tooling(root, "read_process_output", `{"id":"p3"}`)
+	if !strings.Contains(out, "status=exited") {
+		t.Fatalf("StopAll left p3 running: %q", out)
+	}
+}
+
+// processAlive reports whether pid exists and is not a zombie waiting for
+// its (possibly non-reaping) new parent.
+func processAlive(pid int) bool {
+	st, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+	_, rest, _ := strings.Cut(string(st), ") ")
+	return !strings.HasPrefix(rest, "Z")
+}
+
+// TestProcessStdinBlocked gives up on input a process never reads, at the
+// tool timeout or when the run is cancelled, instead of hanging the phase.
+func TestProcessStdinBlocked(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process groups are managed by the Linux helper")
+	}
+	root := t.TempDir()
+	a := newTestAgent(root)
+	a.Policy = pkg.DefaultPolicy()
+	a.Policy.Limits.ToolTimeouts = map[string]time.Duration{"write_process_stdin": 200 * time.Millisecond}
+	defer a.Procs.StopAll()
+
+	if _, err := a.Tooling(root, "start_process", `{"cmd":"sleep 300","permissions":"r"}`); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	// far more than a pipe buffer holds
+	input := `{"id":"p1","input":"` + strings.Repeat("x", 1<<20) + `"}`
+
+	start := time.Now()
+	_, err := a.Tooling(root, "write_process_stdin", input)
+	var te *pkg.ToolTimeoutError
+	if !errors.As(err, &te) || te.Rule != "limits.tool_timeouts.write_process_stdin" || !strings.Contains(err.Error(), "not reading its input") {
+		t.Fatalf("expected tool timeout, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("blocked write took %s", d)
+	}
+
+	a.Policy.Limits.ToolTimeouts["write_process_stdin"] = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	start = time.Now()
+	if _, err := a.ToolingContext(ctx, root, "c", "write_process_stdin", input); err == nil || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected interruption, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("cancelled write took %s", d)
+	}
+}
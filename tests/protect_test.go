@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cds.agents.app/internal/services/agent"
+	"cds.agents.app/pkg"
+)
+
+// TestProtectedPaths refuses every tool change to protected paths, including
+// deleting a directory that contains one.
+func TestProtectedPaths(t *testing.T) {
+	root := t.TempDir()
+	for p, body := range map[string]string{
+		".git/HEAD":                 "ref: refs/heads/main\n",
+		"go.sum":                    "sum\n",
+		"tools/go.sum":              "sum\n",
+		".github/workflows/ci.yml":  "on: push\n",
+		"vendor/x/x.go":             "package x\n",
+		"internal/app/app.go":       "package app\n",
+		"internal/app/gen/proto.pb": "pb\n",
+		".agent/policy.yaml":        "sandbox: {mode: required}\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, p)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, p), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a := newTestAgent(root)
+	a.Policy = pkg.DefaultPolicy()
+	a.Policy.Paths.Protect = append(a.Policy.Paths.Protect, "internal/app/gen/**")
+
+	refused := []struct{ tool, args string }{
+		{"write_file", `{"path":".git/config","content":"x"}`},
+		{"write_file", `{"path":"tools/go.sum","content":"x"}`},
+		{"write_file", `{"path":".github/workflows/release.yml","content":"x"}`},
+		{"delete_path", `{"path":"vendor"}`},
+		{"delete_path", `{"path":".github"}`},
+		{"delete_path", `{"path":"tools"}`},
+		{"delete_path", `{"path":"internal"}`},
+		{"write_file", `{"path":".agent/policy.yaml","content":"sandbox: {mode: off}"}`},
+		{"write_file", `{"path":".agent/approvals.json","content":"{}"}`},
+		{"delete_path", `{"path":".agent"}`},
+		{"run_command", `{"cmd":"echo x >> go.sum","permissions":"rw"}`},
+	}
+	for _, c := range refused {
+		_, err := a.Tooling(root, c.tool, c.args)
+		var perr *pkg.PolicyError
+		if !errors.As(err, &perr) || perr.Rule != "paths.protect" {
+			t.Errorf("%s %s: expected paths.protect refusal, got %v", c.tool, c.args, err)
+		}
+	}
+	for _, p := range []string{".git/HEAD", "tools/go.sum", "vendor/x/x.go", ".github/workflows/ci.yml", "internal/app/app.go", ".agent/policy.yaml"} {
+		if _, err := os.Stat(filepath.Join(root, p)); err != nil {
+			t.Errorf("%s was modified: %v", p, err)
+		}
+	}
+	if _, err := a.Tooling(root, "delete_path", `{"path":"internal/app/app.go"}`); err != nil {
+		t.Fatalf("unprotected delete: %v", err)
+	}
+
+	// writes the parser cannot see are stopped by the sandbox's read-only mounts
+	if status := pkg.SandboxStatus(pkg.SandboxAuto); strings.Contains(status, "network isolated") {
+		a.Tooling(root, "run_command", `{"cmd":"awk 'BEGIN{print 1 > \"ok.txt\"; close(\"ok.txt\"); print 1 > \"go.sum\"}'; awk 'BEGIN{print 1 > \".git/HEAD\"}'; awk 'BEGIN{print 1 > \".agent/approvals.json\"}'","permissions":"rw"}`)
+		for p, want := range map[string]string{"go.sum": "sum\n", ".git/HEAD": "ref: refs/heads/main\n", "ok.txt": "1\n", ".agent/approvals.json": ""} {
+			if b, _ := os.ReadFile(filepath.Join(root, p)); string(b) != want {
+				t.Errorf("after awk %s = %q, want %q", p, b, want)
+			}
+		}
+	}
+}
+
+// TestAgentStateProtected keeps the policy and approvals files out of every
+// tool's reach when the repo's policy replaces the paths.protect list.
+func TestAgentStateProtected(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, ".agent"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, pkg.PolicyFile), []byte("paths:\n  protect: [\"secrets/**\"]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	policy, _, err := pkg.ResolvePolicy(root, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := agent.NewAgent(pkg.Config{Model: "gpt-4o", Src: root, Concurrency: 2, Steps: 4, Timeout: time.Minute, Policy: policy, AuditLog: "none"})
+	for _, c := range [][2]string{
+		{"write_file", `{"path":".agent/approvals.json","content":"{}"}`},
+		{"write_file", `{"path":".agent/policy.yaml","content":"{}"}`},
+		{"run_command", `{"cmd":"echo '{}' > .agent/approvals.json","permissions":"rw"}`},
+		{"delete_path", `{"path":".agent"}`},
+	} {
+		var perr *pkg.PolicyError
+		if _, err := a.Tooling(root, c[0], c[1]); !errors.As(err, &perr) || perr.Rule != "paths.protect" {
+			t.Errorf("%s %s: expected paths.protect, got %v", c[0], c[1], err)
+		}
+	}
+	if len(policy.Paths.Protect) != 1 {
+		t.Fatalf("caller's policy was modified: %v", policy.Paths.Protect)
+	}
+
+	// writes the parser cannot see are stopped by the sandbox, even before
+	// approvals.json exists
+	if status := pkg.SandboxStatus(pkg.SandboxAuto); strings.Contains(status, "network isolated") {
+		a.Tooling(root, "run_command", `{"cmd":"awk 'BEGIN{print 1 > \".agent/approvals.json\"}'; awk 'BEGIN{print 1 > \".agent/policy.yaml\"}'","permissions":"rw"}`)
+		if _, err := os.Stat(filepath.Join(root, pkg.ApprovalsFile)); err == nil {
+			t.Errorf("a command created %s", pkg.ApprovalsFile)
+		}
+		if b, _ := os.ReadFile(filepath.Join(root, pkg.PolicyFile)); !strings.Contains(string(b), "secrets/**") {
+			t.Errorf("a command rewrote %s: %q", pkg.PolicyFile, b)
+		}
+	}
+}
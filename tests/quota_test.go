@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cds.agents.app/pkg"
+)
+
+// TestQuotas refuses calls over the run's quotas and reports what is left.
+func TestQuotas(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "d"), 0o755)
+	for _, f := range []string{"d/1", "d/2", "d/3", "lone"} {
+		os.WriteFile(filepath.Join(root, f), []byte("x"), 0o644)
+	}
+	a := newTestAgent(root)
+	a.Quotas = pkg.NewQuotaTracker(pkg.QuotaRules{MaxFilesWritten: 2, MaxBytesWritten: 100, MaxDeletions: 2, MaxCommands: 1, Tools: map[string]int{"list_dir": 1}})
+
+	refused := func(name, args, rule string) {
+		t.Helper()
+		_, err := a.Tooling(root, name, args)
+		var qerr *pkg.QuotaError
+		if !errors.As(err, &qerr) || qerr.Rule != rule {
+			t.Fatalf("%s %s: want %s refusal, got %v", name, args, rule, err)
+		}
+	}
+	ok := func(name, args string) {
+		t.Helper()
+		if _, err := a.Tooling(root, name, args); err != nil {
+			t.Fatalf("%s %s: %v", name, args, err)
+		}
+	}
+
+	// a write that fails costs nothing
+	if _, err := a.Tooling(root, "write_file", `{"path":"d","content":"0123456789"}`); err == nil {
+		t.Fatalf("write over a directory succeeded")
+	}
+	if left := a.Quotas.Remaining("write_file"); left != "2 files, 100 B written" {
+		t.Fatalf("failed write was charged: %q", left)
+	}
+	ok("write_file", `{"path":"a.txt","content":"0123456789"}`)
+	ok("write_file", `{"path":"b.txt","content":"0123456789"}`)
+	if left := a.Quotas.Remaining("write_file"); left != "0 files, 80 B written" {
+		t.Fatalf("remaining: %q", left)
+	}
+	if a.Quotas.Exceeded() != nil {
+		t.Fatalf("exceeded before any refusal")
+	}
+	refused("write_file", `{"path":"c.txt","content":"x"}`, "quotas.max_files_written")
+	ok("write_file", `{"path":"a.txt","content":"rewrite"}`)
+	refused("write_file", `{"path":"a.txt","content":"`+strings.Repeat("x", 80)+`"}`, "quotas.max_bytes_written")
+
+	refused("delete_path", `{"path":"d"}`, "quotas.max_deletions")
+	ok("delete_path", `{"path":"lone"}`)
+	if _, err := os.Stat(filepath.Join(root, "d", "1")); err != nil {
+		t.Fatalf("refused delete removed files: %v", err)
+	}
+
+	ok("run_command", `{"cmd":"true","permissions":"r"}`)
+	refused("run_command", `{"cmd":"true","permissions":"r"}`, "quotas.max_commands")
+	ok("list_dir", `{"dir":"."}`)
+	refused("list_dir", `{"dir":"."}`, "quotas.tools.list_dir")
+
+	if err := a.Quotas.Exceeded(); err == nil || !strings.Contains(err.Error(), "run stops after this turn (quotas.max_files_written)") {
+		t.Fatalf("first refusal not kept: %v", err)
+	}
+	if u := a.Quotas.Usage(); u != "2 files written (27 B), 1 deletions, 1 commands, 1 list_dir calls" {
+		t.Fatalf("usage: %q", u)
+	}
+}
@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestChangeReport covers created/modified/deleted entries with line counts and diffs.
+func TestChangeReport(t *testing.T) {
+	root := makeNested(t)
+	a := newTestAgent(root)
+	calls := [][2]string{
+		{"write_file", `{"path":"a/x.txt","content":"x\ny\n"}`},
+		{"write_file", `{"path":"new.txt","content":"n\n"}`},
+		{"delete_path", `{"path":"a/b"}`},
+		{"write_file", `{"path":"tmp.txt","content":"t"}`},
+		{"delete_path", `{"path":"tmp.txt"}`},
+	}
+	for _, c := range calls {
+		if _, err := a.Tooling(root, c[0], c[1]); err != nil {
+			t.Fatalf("%s err: %v", c[0], err)
+		}
+	}
+
+	r := a.Changes.Report(a.Ws)
+	got := map[string]string{}
+	for _, f := range r.Files {
+		got[f.Path] = f.Status
+	}
+	want := map[string]string{"a/x.txt": "modified", "new.txt": "created", "a/b/y.txt": "deleted", "a/b/c/z.txt": "deleted"}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected files: %v", got)
+	}
+	for p, s := range want {
+		if got[p] != s {
+			t.Fatalf("%s: want %s got %q (all=%v)", p, s, got[p], got)
+		}
+	}
+	if r.Files[2].Path != "a/x.txt" || r.Files[2].Added != 2 || r.Files[2].Removed != 1 {
+		t.Fatalf("unexpected line counts: %+v", r.Files[2])
+	}
+	md := r.Markdown()
+	if !strings.Contains(md, "| modified | `a/x.txt` | 2 | 1 |") || !strings.Contains(md, "```diff\n--- /dev/null\n+++ b/new.txt") {
+		t.Fatalf("unexpected markdown:\n%s", md)
+	}
+}
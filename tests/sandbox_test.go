@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cds.agents.app/pkg"
+)
+
+// TestRunCommandSandbox checks that permissions hold for commands the static
+// analysis cannot see through (awk writes, reads outside --src, sockets).
+func TestRunCommandSandbox(t *testing.T) {
+	status := pkg.SandboxStatus(pkg.SandboxAuto)
+	if !strings.Contains(status, "Landlock") {
+		t.Skip("kernel sandbox unavailable: " + status)
+	}
+	base := t.TempDir()
+	root, outside := filepath.Join(base, "src"), filepath.Join(base, "outside")
+	for _, d := range []string{root, outside} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("s3cret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a := newTestAgent(root)
+	awk := `awk 'BEGIN{print 1 > \"f.txt\"}'`
+
+	// "r" is genuinely read-only
+	a.Tooling(root, "run_command", `{"cmd":"`+awk+`","permissions":"r"}`)
+	if _, err := os.Stat(filepath.Join(root, "f.txt")); !os.IsNotExist(err) {
+		t.Fatalf("read-only command created a file")
+	}
+	if _, err := a.Tooling(root, "run_command", `{"cmd":"`+awk+`","permissions":"rw"}`); err != nil {
+		t.Fatalf("rw awk: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "f.txt")); err != nil {
+		t.Fatalf("rw command could not write: %v", err)
+	}
+
+	// nothing outside --src is readable
+	out, _ := a.Tooling(root, "run_command", `{"cmd":"cat `+filepath.Join(outside, "secret")+`","permissions":"rw"}`)
+	if strings.Contains(out, "s3cret") {
+		t.Fatalf("sandbox leaked a file outside --src: %q", out)
+	}
+
+	// no network unless the policy allows it
+	if strings.Contains(status, "network isolated") {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		addr := ln.Addr().(*net.TCPAddr)
+		cmd := `{"cmd":"echo hi > /dev/tcp/127.0.0.1/` + strings.TrimPrefix(addr.String(), "127.0.0.1:") + `","permissions":"rw"}`
+		if _, err := a.Tooling(root, "run_command", cmd); err == nil {
+			t.Fatalf("sandboxed command reached the network")
+		}
+	}
+
+	// mode off restores the unconfined behavior
+	a.Policy = pkg.DefaultPolicy()
+	a.Policy.Sandbox.Mode = pkg.SandboxOff
+	os.Remove(filepath.Join(root, "f.txt"))
+	a.Tooling(root, "run_command", `{"cmd":"`+awk+`","permissions":"r"}`)
+	if _, err := os.Stat(filepath.Join(root, "f.txt")); err != nil {
+		t.Fatalf("sandbox off: awk write failed: %v", err)
+	}
+}
+
+// TestRunCommandHidesDenied masks paths.deny matches from commands whose
+// reads the analysis cannot attribute.
+func TestRunCommandHidesDenied(t *testing.T) {
+	if status := pkg.SandboxStatus(pkg.SandboxAuto); !strings.Contains(status, "network isolated") {
+		t.Skip("mount namespaces unavailable: " + status)
+	}
+	root := t.TempDir()
+	for p, body := range map[string]string{"secrets/prod.env": "TOKEN=s3cret\n", "notes.txt": "plain\n", "key.pem": "s3cret-pem\n"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(root, p)), 0o755)
+		if err := os.WriteFile(filepath.Join(root, p), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a := newTestAgent(root)
+	a.Policy = pkg.DefaultPolicy()
+	a.Policy.Paths.Deny = []string{"secrets/**", "*.pem"}
+
+	if _, err := a.Tooling(root, "run_command", `{"cmd":"cat secrets/prod.env","permissions":"r"}`); err == nil || !strings.Contains(err.Error(), "paths.deny") {
+		t.Fatalf("visible read of a denied path: %v", err)
+	}
+	out, _ := a.Tooling(root, "run_command", `{"cmd":"find . -type f -exec cat {} +","permissions":"rw"}`)
+	if !strings.Contains(out, "plain") || strings.Contains(out, "s3cret") {
+		t.Fatalf("denied paths not hidden:\n%s", out)
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, "key.pem")); string(b) != "s3cret-pem\n" {
+		t.Fatalf("hidden file changed on the host: %q", b)
+	}
+}
@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cds.agents.app/pkg"
+	"github.com/openai/openai-go/v2"
+)
+
+// TestScheduler weights calls against the pool and caps tools.
+func TestScheduler(t *testing.T) {
+	s := pkg.NewScheduler(4, pkg.ScheduleRules{
+		Weights:       map[string]int{"run_command": 3, "huge": 10},
+		MaxConcurrent: map[string]int{"read_file": 2},
+	})
+	if s.Weight("run_command") != 3 || s.Weight("list_dir") != 1 || s.Weight("huge") != 4 {
+		t.Fatalf("weights: %d %d %d", s.Weight("run_command"), s.Weight("list_dir"), s.Weight("huge"))
+	}
+	blocked := func(tool string) bool {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		release, err := s.Acquire(ctx, tool)
+		if err != nil {
+			return true
+		}
+		release()
+		return false
+	}
+
+	cmd, _ := s.Acquire(context.Background(), "run_command")
+	if blocked("list_dir") || !blocked("run_command") {
+		t.Fatal("run_command should leave exactly one slot")
+	}
+	list, _ := s.Acquire(context.Background(), "list_dir")
+	if !blocked("read_file") {
+		t.Fatal("read_file ran in a full pool")
+	}
+	cmd()
+	r1, _ := s.Acquire(context.Background(), "read_file")
+	r2, _ := s.Acquire(context.Background(), "read_file")
+	if !blocked("read_file") {
+		t.Fatal("third read_file ran despite max_concurrent 2")
+	}
+	if blocked("write_file") {
+		t.Fatal("write_file held back by read_file's cap")
+	}
+	list()
+	r1()
+	r2()
+	if blocked("huge") {
+		t.Fatal("a tool heavier than the pool never runs")
+	}
+	if got := s.String(); got != "4 slots; weights huge=10, run_command=3; max read_file=2" {
+		t.Fatalf("String: %q", got)
+	}
+}
+
+// TestSchedulerShared holds back an agent's calls while another user of
+// the same pool has every slot.
+func TestSchedulerShared(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o644)
+	shared := pkg.NewScheduler(2, pkg.ScheduleRules{Weights: map[string]int{"run_command": 2}})
+	a := newTestAgent(root)
+	a.Scheduler = shared
+
+	hold, _ := shared.Acquire(context.Background(), "run_command") // e.g. another session's command
+	done := make(chan struct{})
+	go func() {
+		msg := openai.ChatCompletionMessage{ToolCalls: []openai.ChatCompletionMessageToolCallUnion{
+			{ID: "c", Type: "function", Function: openai.ChatCompletionMessageFunctionToolCallFunction{Name: "read_file", Arguments: `{"path":"a.txt"}`}},
+		}}
+		calls := pkg.ExtractToolCalls(msg)
+		phases, _ := a.PlanPhases(root, calls)
+		a.RunPhases(calls, phases, msg)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("read_file ran while the shared pool was full")
+	case <-time.After(100 * time.Millisecond):
+	}
+	hold()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("read_file never ran after the pool was released")
+	}
+}
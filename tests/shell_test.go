@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"cds.agents.app/pkg"
+)
+
+// TestAnalyzeCommand checks write/exec classification and rejection of opaque constructs.
+func TestAnalyzeCommand(t *testing.T) {
+	cases := []struct {
+		cmd          string
+		writes, exec bool
+		reject       bool
+	}{
+		{cmd: "echo ncurses"},
+		{cmd: `echo "a > b" 'c >> d'`},
+		{cmd: "git status | grep -c M"},
+		{cmd: "FOO=1 go test ./... 2>&1"},
+		{cmd: "cat < in.txt > /dev/null"},
+		{cmd: "git -C sub log --oneline"},
+		{cmd: "sh -lc 'echo hi > f.txt'", writes: true},
+		{cmd: "(cd a && rm x)", writes: true},
+		{cmd: "echo $(rm x)", writes: true},
+		{cmd: `\rm x`, writes: true},
+		{cmd: "ls | xargs -n 1 rm", writes: true},
+		{cmd: `find . -name '*.tmp' -exec rm {} \;`, writes: true},
+		{cmd: "find . -delete", writes: true},
+		{cmd: "sed -i s/a/b/ f.txt", writes: true},
+		{cmd: "go mod tidy", writes: true},
+		{cmd: "git commit -m x", writes: true},
+		{cmd: "timeout 5s tee out.log", writes: true},
+		{cmd: "sort -o out.txt in.txt", writes: true},
+		{cmd: "sort --output=out.txt in.txt", writes: true},
+		{cmd: "git log -c --oneline"},
+		{cmd: "git grep -c foo"},
+		{cmd: "git -c core.pager='sh -c x' log", writes: true, exec: true},
+		{cmd: "git diff --output=f", writes: true, exec: true},
+		{cmd: "git diff --ext-diff", writes: true, exec: true},
+		{cmd: "command -v rm"},
+		{cmd: "trap - EXIT"},
+		{cmd: "./tool.sh", exec: true},
+		{cmd: "bash script.sh", exec: true},
+		{cmd: "python3 -c 'print(1)'", exec: true},
+		{cmd: `bash -c "$(printf rm) -rf x"`, reject: true},
+		{cmd: "$CMD x", reject: true},
+		{cmd: "PATH=/tmp ls", reject: true},
+		{cmd: "GIT_PAGER='sh -c x' git log", reject: true},
+		{cmd: "GIT_EXTERNAL_DIFF=./x git diff", reject: true},
+		{cmd: "PAGER=./x git log", reject: true},
+		{cmd: "EDITOR=./x git log", reject: true},
+		{cmd: "IFS=/ ls", reject: true},
+		{cmd: "env GIT_PAGER=./x git log", reject: true},
+		{cmd: "shopt -s expand_aliases; alias x='rm -rf src'; x", reject: true},
+		{cmd: "alias x='rm -rf src'", reject: true},
+		{cmd: `trap "$X" EXIT`, reject: true},
+		{cmd: `env -S "$X"`, reject: true},
+		{cmd: "eval \"$X\"", reject: true},
+		{cmd: "echo hi > $OUT", reject: true},
+		{cmd: "echo 'unterminated", reject: true},
+	}
+	for _, c := range cases {
+		an, err := pkg.AnalyzeCommand(c.cmd)
+		if c.reject {
+			if err == nil {
+				t.Errorf("%q: expected rejection", c.cmd)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.cmd, err)
+			continue
+		}
+		if an.Writes != c.writes {
+			t.Errorf("%q: writes=%v want %v (%v)", c.cmd, an.Writes, c.writes, an.WriteReasons)
+		}
+		if (len(an.ExecPaths) > 0) != c.exec {
+			t.Errorf("%q: exec=%v want %v", c.cmd, an.ExecPaths, c.exec)
+		}
+	}
+}
+
+// TestAnalyzeCommandWrappers finds the program behind wrappers and deferred
+// actions, and the files sed edits in place.
+func TestAnalyzeCommandWrappers(t *testing.T) {
+	for _, cmd := range []string{
+		`trap "rm -rf src" EXIT`,
+		"exec -a foo rm -rf src",
+		`env -S "rm -rf src"`,
+		`env -iS"rm -rf" src`,
+		"env --split-string='rm -rf' src",
+		"setsid rm -rf src",
+		"flock /tmp/l rm -rf src",
+		"flock -w 5 /tmp/l -c 'rm -rf src'",
+		"watch -n 1 rm -rf src",
+		"watch -x rm -rf src",
+		"busybox rm -rf src",
+	} {
+		an, err := pkg.AnalyzeCommand(cmd)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", cmd, err)
+			continue
+		}
+		if !an.Writes || !slices.Contains(an.Programs(), "rm") || !slices.Contains(an.WritePaths, "src") {
+			t.Errorf("%q: programs=%v writes=%v paths=%v", cmd, an.Programs(), an.Writes, an.WritePaths)
+		}
+	}
+
+	for cmd, want := range map[string]string{
+		"sed -e s/a/b/ -i f":           "f",
+		"sed -i s/a/b/ f g":            "f g",
+		"sed -i.ref s/a/b/ f":          "f",
+		"sed -n -i -f script.sed f":    "f",
+		"sed --expression=s/a/b/ -i f": "f",
+	} {
+		an, err := pkg.AnalyzeCommand(cmd)
+		if err != nil || strings.Join(an.WritePaths, " ") != want {
+			t.Errorf("%q: write paths %v, want %s (err=%v)", cmd, an.WritePaths, want, err)
+		}
+	}
+}
+
+// TestRunCommand_Denylist ensures denied programs are matched by name, not substring.
+func TestRunCommand_Denylist(t *testing.T) {
+	root := t.TempDir()
+	a := newTestAgent(root)
+	out, err := a.Tooling(root, "run_command", `{"cmd":"echo ncurses","permissions":"r"}`)
+	if err != nil || !strings.Contains(out, "ncurses") {
+		t.Fatalf("echo ncurses: %q err=%v", out, err)
+	}
+	if _, err := a.Tooling(root, "run_command", `{"cmd":"ls | nc host 1","permissions":"rwx"}`); err == nil {
+		t.Fatalf("expected nc to be denied")
+	}
+	if _, err := a.Tooling(root, "run_command", `{"cmd":"rm -rf /","permissions":"rwx"}`); err == nil {
+		t.Fatalf("expected rm -rf / to be denied")
+	}
+}
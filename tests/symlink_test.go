@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"cds.agents.app/pkg"
+)
+
+// makeLinked builds a source tree with in-tree and escaping symlinks next to
+// an outside directory holding a secret.
+func makeLinked(t *testing.T) (root, outside string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on windows")
+	}
+	base := t.TempDir()
+	root, outside = filepath.Join(base, "src"), filepath.Join(base, "outside")
+	must := func(err error) {
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	must(os.MkdirAll(filepath.Join(root, "real"), 0o755))
+	must(os.MkdirAll(outside, 0o755))
+	must(os.WriteFile(filepath.Join(outside, "secret"), []byte("s3cret"), 0o644))
+	must(os.WriteFile(filepath.Join(root, "real", "f.txt"), []byte("in-tree"), 0o644))
+	must(os.Symlink(outside, filepath.Join(root, "abs-out")))                   // absolute escape
+	must(os.Symlink("../outside", filepath.Join(root, "rel-out")))              // relative escape
+	must(os.Symlink("real", filepath.Join(root, "alias")))                      // in-tree dir
+	must(os.Symlink("alias/f.txt", filepath.Join(root, "chain")))               // link through link
+	must(os.Symlink(filepath.Join(root, "real"), filepath.Join(root, "absin"))) // absolute, in-tree
+	return root, outside
+}
+
+// TestSymlinkEscape ensures links out of --src are refused for every FS tool.
+func TestSymlinkEscape(t *testing.T) {
+	root, outside := makeLinked(t)
+	a := newTestAgent(root)
+	calls := []struct{ tool, args string }{
+		{"read_file", `{"path":"abs-out/secret"}`},
+		{"read_file", `{"path":"rel-out/secret"}`},
+		{"list_dir", `{"dir":"abs-out"}`},
+		{"write_file", `{"path":"rel-out/secret","content":"pwned"}`},
+		{"write_file", `{"path":"abs-out/new.txt","content":"pwned"}`},
+		{"delete_path", `{"path":"abs-out/secret"}`},
+	}
+	for _, c := range calls {
+		if _, err := a.Tooling(root, c.tool, c.args); !errors.Is(err, pkg.ErrOutsideRoot) {
+			t.Errorf("%s %s: expected ErrOutsideRoot, got %v", c.tool, c.args, err)
+		}
+	}
+	// the disk backend refuses escapes on its own (link swapped after resolution)
+	ws := pkg.NewOSWorkspace(root)
+	if _, err := ws.ReadFile(filepath.Join(root, "abs-out", "secret")); err == nil {
+		t.Errorf("OSWorkspace followed a link out of the root")
+	}
+	if err := ws.WriteFile(filepath.Join(root, "rel-out", "secret"), []byte("pwned")); err == nil {
+		t.Errorf("OSWorkspace wrote through a link out of the root")
+	}
+	if b, _ := os.ReadFile(filepath.Join(outside, "secret")); string(b) != "s3cret" {
+		t.Fatalf("outside file modified: %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new.txt")); !os.IsNotExist(err) {
+		t.Fatalf("file created outside the sandbox")
+	}
+}
+
+// TestSymlinkInTree covers following, deleting and refusing in-tree links.
+func TestSymlinkInTree(t *testing.T) {
+	root, _ := makeLinked(t)
+	a := newTestAgent(root)
+
+	for _, p := range []string{"alias/f.txt", "chain", "absin/f.txt"} {
+		out, err := a.Tooling(root, "read_file", `{"path":"`+p+`"}`)
+		if err != nil || out != "in-tree" {
+			t.Errorf("read %s: %q err=%v", p, out, err)
+		}
+	}
+	if _, err := a.Tooling(root, "write_file", `{"path":"chain","content":"updated"}`); err != nil {
+		t.Fatalf("write through link: %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, "real", "f.txt")); string(b) != "updated" {
+		t.Fatalf("write did not reach the link target: %q", b)
+	}
+	if fi, err := os.Lstat(filepath.Join(root, "chain")); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("link replaced by a regular file: %v", err)
+	}
+
+	// delete_path removes the link itself, never the target
+	if _, err := a.Tooling(root, "delete_path", `{"path":"alias"}`); err != nil {
+		t.Fatalf("delete link: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "alias")); !os.IsNotExist(err) {
+		t.Fatalf("link still present: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "real", "f.txt")); err != nil {
+		t.Fatalf("link target deleted: %v", err)
+	}
+
+	// policy checks apply to the resolved target, and links can be refused entirely
+	a.Policy = pkg.DefaultPolicy()
+	a.Policy.Paths.Deny = []string{"real/**"}
+	if _, err := a.Tooling(root, "read_file", `{"path":"absin/f.txt"}`); err == nil || !strings.Contains(err.Error(), "paths.deny") {
+		t.Fatalf("expected paths.deny on link target, got %v", err)
+	}
+	a.Policy = pkg.DefaultPolicy()
+	a.Policy.Paths.Symlinks = pkg.SymlinksNone
+	if _, err := a.Tooling(root, "read_file", `{"path":"chain"}`); err == nil || !strings.Contains(err.Error(), "symlink not followed") {
+		t.Fatalf("expected symlink refusal, got %v", err)
+	}
+	if _, err := a.Tooling(root, "read_file", `{"path":"real/f.txt"}`); err != nil {
+		t.Fatalf("plain path with symlinks=none: %v", err)
+	}
+}
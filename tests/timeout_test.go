@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cds.agents.app/pkg"
+)
+
+// TestToolTimeout stops a tree walk at its per-tool deadline and reports a
+// structured timeout naming the rule.
+func TestToolTimeout(t *testing.T) {
+	root := makeNested(t)
+	a := newTestAgent(root)
+	a.Policy = pkg.DefaultPolicy()
+	a.Policy.Limits.ToolTimeouts = map[string]time.Duration{"list_dir_recursive": time.Nanosecond}
+
+	_, err := a.Tooling(root, "list_dir_recursive", `{"dir":"."}`)
+	var te *pkg.ToolTimeoutError
+	if !errors.As(err, &te) || te.Rule != "limits.tool_timeouts.list_dir_recursive" || !strings.HasPrefix(err.Error(), "timeout: list_dir_recursive ") {
+		t.Fatalf("expected tool timeout, got %v", err)
+	}
+	// other tools keep limits.tool_timeout
+	if _, err := a.Tooling(root, "list_dir", `{"dir":"."}`); err != nil {
+		t.Fatalf("list_dir: %v", err)
+	}
+	// mutating tools run to completion, so their outcome is always known
+	a.Policy.Limits.ToolTimeouts["write_file"] = time.Nanosecond
+	if _, err := a.Tooling(root, "write_file", `{"path":"w.txt","content":"w"}`); err != nil {
+		t.Fatalf("write_file under a deadline: %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, "w.txt")); string(b) != "w" {
+		t.Fatalf("write_file content %q", b)
+	}
+}
+
+// TestParseToolDurations reads --tool-timeout values.
+func TestParseToolDurations(t *testing.T) {
+	got, err := pkg.ParseToolDurations("tool-timeout", []string{"list_dir_recursive=2m", "read_file=500ms"})
+	if err != nil || got["list_dir_recursive"] != 2*time.Minute || got["read_file"] != 500*time.Millisecond {
+		t.Fatalf("got %v, %v", got, err)
+	}
+	for _, bad := range []string{"read_file", "=1s", "read_file=soon", "read_file=-1s"} {
+		if _, err := pkg.ParseToolDurations("tool-timeout", []string{bad}); err == nil {
+			t.Fatalf("%q: expected error", bad)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+//go:build unix
+
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"cds.agents.app/pkg"
+)
+
+// TestToolTimeoutHungRead abandons a read that blocks in the kernel (a FIFO
+// with no writer, standing in for a hung mount) instead of stalling the phase.
+func TestToolTimeoutHungRead(t *testing.T) {
+	root := t.TempDir()
+	fifo := filepath.Join(root, "pipe")
+	if err := syscall.Mkfifo(fifo, 0o644); err != nil {
+		t.Skipf("mkfifo: %v", err)
+	}
+	// a writer end releases the abandoned read when the test ends
+	t.Cleanup(func() {
+		if f, err := os.OpenFile(fifo, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+			f.Close()
+		}
+	})
+	a := newTestAgent(root)
+	a.Policy = pkg.DefaultPolicy()
+	a.Policy.Limits.ToolTimeout = 200 * time.Millisecond
+
+	start := time.Now()
+	_, err := a.Tooling(root, "read_file", `{"path":"pipe"}`)
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("hung read took %s", d)
+	}
+	var te *pkg.ToolTimeoutError
+	if !errors.As(err, &te) || te.Rule != "limits.tool_timeout" || te.Limit != 200*time.Millisecond {
+		t.Fatalf("expected tool timeout, got %v", err)
+	}
+}
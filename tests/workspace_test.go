@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"cds.agents.app/internal/services/agent"
+	"cds.agents.app/pkg"
+)
+
+// newMemAgent creates a test agent backed by an in-memory workspace.
+func newMemAgent(root string) (*agent.Agent, *pkg.MemWorkspace) {
+	ws := pkg.NewMemWorkspace(root)
+	a := &agent.Agent{Ws: ws}
+	a.Init("gpt-4o", root, 2, 1, 0, "test")
+	return a, ws
+}
+
+// TestMemWorkspaceTools runs the FS tools against a virtual tree.
+func TestMemWorkspaceTools(t *testing.T) {
+	root := "/virtual"
+	a, ws := newMemAgent(root)
+	if err := ws.WriteFile("/virtual/a/b/y.txt", []byte("y")); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	if _, err := a.Tooling(root, "write_file", `{"path":"a/x.txt","content":"x"}`); err != nil {
+		t.Fatalf("write_file err: %v", err)
+	}
+	out, err := a.Tooling(root, "list_dir", `{"dir":"a"}`)
+	if err != nil {
+		t.Fatalf("list_dir err: %v", err)
+	}
+	if out != "DIR  b\nFILE x.txt\n" {
+		t.Fatalf("unexpected listing: %q", out)
+	}
+	out, err = a.Tooling(root, "list_dir_recursive", `{"dir":"."}`)
+	if err != nil {
+		t.Fatalf("list_dir_recursive err: %v", err)
+	}
+	if !strings.Contains(out, "FILE a/b/y.txt") {
+		t.Fatalf("expected nested file, got:\n%s", out)
+	}
+	if _, err := a.Tooling(root, "delete_path", `{"path":"a/b"}`); err != nil {
+		t.Fatalf("delete_path err: %v", err)
+	}
+	if _, err := a.Tooling(root, "read_file", `{"path":"a/b/y.txt"}`); err == nil {
+		t.Fatalf("expected deleted file to be gone")
+	}
+	if _, err := a.Tooling(root, "run_command", `{"cmd":"ls","permissions":"r"}`); err == nil {
+		t.Fatalf("expected run_command to refuse a virtual tree")
+	}
+}
+
+// TestOverlayOverMemWorkspace ensures the overlay never mutates its base.
+func TestOverlayOverMemWorkspace(t *testing.T) {
+	base := pkg.NewMemWorkspace("/v")
+	_ = base.WriteFile("/v/keep.txt", []byte("old\n"))
+	ov := pkg.NewOverlayWorkspace("/v", base)
+
+	_ = ov.WriteFile("/v/keep.txt", []byte("new\n"))
+	_ = ov.RemoveAll("/v/keep.txt")
+	_ = ov.WriteFile("/v/keep.txt", []byte("again\n"))
+
+	if b, _ := ov.ReadFile("/v/keep.txt"); string(b) != "again\n" {
+		t.Fatalf("overlay read: %q", b)
+	}
+	if b, _ := base.ReadFile("/v/keep.txt"); string(b) != "old\n" {
+		t.Fatalf("base modified: %q", b)
+	}
+	ch := ov.Changes()
+	if len(ch) != 1 || ch[0].Created || ch[0].Path != "keep.txt" || string(ch[0].Before) != "old\n" {
+		t.Fatalf("unexpected changes: %+v", ch)
+	}
+}
+
+// TestOverlayDirReplacedByFile keeps a deleted directory's contents deleted
+// after a file is written at its path.
+func TestOverlayDirReplacedByFile(t *testing.T) {
+	base := pkg.NewMemWorkspace("/v")
+	_ = base.WriteFile("/v/a/b.txt", []byte("b\n"))
+	_ = base.WriteFile("/v/a/c/d.txt", []byte("d\n"))
+	ov := pkg.NewOverlayWorkspace("/v", base)
+
+	if err := ov.RemoveAll("/v/a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ov.WriteFile("/v/a", []byte("file\n")); err != nil {
+		t.Fatalf("write over deleted dir: %v", err)
+	}
+	if b, err := ov.ReadFile("/v/a/b.txt"); err == nil {
+		t.Fatalf("deleted child came back: %q", b)
+	}
+	if b, _ := ov.ReadFile("/v/a"); string(b) != "file\n" {
+		t.Fatalf("new file: %q", b)
+	}
+	var got []string
+	for _, c := range ov.Changes() {
+		got = append(got, fmt.Sprintf("%s created=%v deleted=%v", c.Path, c.Created, c.Deleted))
+	}
+	if want := "a created=true deleted=false|a/b.txt created=false deleted=true|a/c/d.txt created=false deleted=true"; strings.Join(got, "|") != want {
+		t.Fatalf("changes:\n%s\nwant:\n%s", strings.Join(got, "|"), want)
+	}
+}